@@ -0,0 +1,159 @@
+package implstub
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"strings"
+)
+
+// accessProblem 生成するコードがインターフェースを満たせない、もしくは書けない理由
+type accessProblem struct {
+	pos token.Position
+	msg string
+}
+
+// checkAccess 出力先のパッケージから実装できない非公開メソッドや、参照できない型を含むシグネチャを探す
+// レシーバーを選択するモードでは実装済みのメソッドは対象にしない
+func (g *genContext) checkAccess() []accessProblem {
+	dst := g.r.pkg
+	if dst == nil {
+		return nil
+	}
+
+	var problems []accessProblem
+	for i := 0; i < g.iface.NumMethods(); i++ {
+		m := g.iface.Method(i)
+		if g.recv != nil {
+			if status, _ := g.lookupMethod(m); status == methodDeclared || status == methodConflict {
+				continue
+			}
+		}
+
+		pos := g.ifacePkg.Fset.Position(m.Pos())
+		if g.foreignUnexported(m) {
+			problems = append(problems, accessProblem{
+				pos: pos,
+				msg: fmt.Sprintf("%s.%s is unexported in %s and cannot be implemented in %s", g.ifaceObj.Name(), m.Name(), m.Pkg().Path(), dst.Path()),
+			})
+			continue
+		}
+
+		for _, obj := range inaccessibleTypes(m.Type(), dst, make(map[types.Type]bool)) {
+			reason := "is unexported"
+			if obj.Exported() {
+				reason = "is in an internal package"
+			}
+			problems = append(problems, accessProblem{
+				pos: pos,
+				msg: fmt.Sprintf("the signature of %s.%s refers to %s.%s, which %s and cannot be referred from %s", g.ifaceObj.Name(), m.Name(), obj.Pkg().Path(), obj.Name(), reason, dst.Path()),
+			})
+		}
+	}
+
+	return problems
+}
+
+// confirmAccess checkAccessで見つかった問題を位置とともに標準エラーに出力し、続けるか確認する
+// Options.Forceが指定されている場合は確認せずに続ける
+func (g *genContext) confirmAccess() error {
+	problems := g.checkAccess()
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, p := range problems {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", p.pos, p.msg)
+	}
+	if g.opt.Force {
+		g.accessAccepted = true
+		return nil
+	}
+
+	answer, err := promptLine(fmt.Sprintf("the generated code will not satisfy %s, generate anyway? [y/N]: ", g.ifaceObj.Name()))
+	if err != nil && err != io.EOF {
+		return err
+	}
+	if strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes") {
+		g.accessAccepted = true
+		return nil
+	}
+
+	return fmt.Errorf("the generated code would not satisfy %s: %d problem(s) found, use --force to generate anyway", g.ifaceObj.Name(), len(problems))
+}
+
+// inaccessibleTypes tに含まれる型のうち、dstのパッケージから参照できない名前つきの型
+func inaccessibleTypes(t types.Type, dst *types.Package, seen map[types.Type]bool) []*types.TypeName {
+	if seen[t] {
+		return nil
+	}
+	seen[t] = true
+
+	switch t := t.(type) {
+	case *types.Named:
+		obj := t.Obj()
+		if obj.Pkg() == nil || obj.Pkg().Path() == dst.Path() {
+			return nil
+		}
+		if !obj.Exported() || !importable(obj.Pkg().Path(), dst.Path()) {
+			return []*types.TypeName{obj}
+		}
+		return nil
+	case *types.Pointer:
+		return inaccessibleTypes(t.Elem(), dst, seen)
+	case *types.Slice:
+		return inaccessibleTypes(t.Elem(), dst, seen)
+	case *types.Array:
+		return inaccessibleTypes(t.Elem(), dst, seen)
+	case *types.Chan:
+		return inaccessibleTypes(t.Elem(), dst, seen)
+	case *types.Map:
+		return append(inaccessibleTypes(t.Key(), dst, seen), inaccessibleTypes(t.Elem(), dst, seen)...)
+	case *types.Signature:
+		var result []*types.TypeName
+		for _, tuple := range []*types.Tuple{t.Params(), t.Results()} {
+			for i := 0; i < tuple.Len(); i++ {
+				result = append(result, inaccessibleTypes(tuple.At(i).Type(), dst, seen)...)
+			}
+		}
+		return result
+	case *types.Struct:
+		var result []*types.TypeName
+		for i := 0; i < t.NumFields(); i++ {
+			result = append(result, inaccessibleTypes(t.Field(i).Type(), dst, seen)...)
+		}
+		return result
+	case *types.Interface:
+		var result []*types.TypeName
+		for i := 0; i < t.NumMethods(); i++ {
+			result = append(result, inaccessibleTypes(t.Method(i).Type(), dst, seen)...)
+		}
+		return result
+	default:
+		return nil
+	}
+}
+
+// importable fromのパッケージからpathのパッケージをimportできるか。internalの制約だけを考慮する
+func importable(path, from string) bool {
+	var parent string
+	switch {
+	case path == "internal" || strings.HasPrefix(path, "internal/"):
+		parent = ""
+	case strings.HasSuffix(path, "/internal"):
+		parent = strings.TrimSuffix(path, "/internal")
+	case strings.Contains(path, "/internal/"):
+		parent = path[:strings.LastIndex(path, "/internal/")]
+	default:
+		return true
+	}
+
+	// 標準ライブラリのinternalは標準ライブラリからしかimportできない
+	if parent == "" {
+		return !strings.Contains(strings.SplitN(from, "/", 2)[0], ".")
+	}
+
+	return from == parent || strings.HasPrefix(from, parent+"/")
+}
@@ -0,0 +1,93 @@
+package implstub
+
+import (
+	"go/build"
+	"os"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// packagesConfig ビルドタグや環境変数を反映したpackages.Configを作成する
+func (opt *Options) packagesConfig(mode packages.LoadMode) *packages.Config {
+	config := &packages.Config{
+		Mode: mode,
+		Env:  opt.environ(),
+	}
+	if len(opt.Tags) > 0 {
+		config.BuildFlags = []string{"-tags=" + strings.Join(opt.Tags, ",")}
+	}
+
+	return config
+}
+
+// environ go listに渡す環境変数。指定がなければnilを返し実行環境のものをそのまま使う
+func (opt *Options) environ() []string {
+	if opt.GOOS == "" && opt.GOARCH == "" && len(opt.Env) == 0 {
+		return nil
+	}
+
+	// 同じキーは後に指定したものが優先される
+	env := os.Environ()
+	if opt.GOOS != "" {
+		env = append(env, "GOOS="+opt.GOOS)
+	}
+	if opt.GOARCH != "" {
+		env = append(env, "GOARCH="+opt.GOARCH)
+	}
+
+	return append(env, opt.Env...)
+}
+
+// lookupEnv environと同じ優先順位で環境変数を探す
+func (opt *Options) lookupEnv(key string) string {
+	env := opt.environ()
+	if env == nil {
+		return os.Getenv(key)
+	}
+
+	value := ""
+	for _, kv := range env {
+		if strings.HasPrefix(kv, key+"=") {
+			value = strings.TrimPrefix(kv, key+"=")
+		}
+	}
+
+	return value
+}
+
+// buildContext ファイル一覧をpackages.Loadと同じビルド制約で絞り込むためのbuild.Context
+func (opt *Options) buildContext() *build.Context {
+	ctx := build.Default
+	if goos := opt.lookupEnv("GOOS"); goos != "" {
+		ctx.GOOS = goos
+	}
+	if goarch := opt.lookupEnv("GOARCH"); goarch != "" {
+		ctx.GOARCH = goarch
+	}
+	if cgo := opt.lookupEnv("CGO_ENABLED"); cgo != "" {
+		ctx.CgoEnabled = cgo == "1"
+	}
+
+	// GOFLAGSで指定されたタグも--tagsと同様に扱う
+	ctx.BuildTags = append(ctx.BuildTags, goflagsTags(opt.lookupEnv("GOFLAGS"))...)
+	ctx.BuildTags = append(ctx.BuildTags, opt.Tags...)
+
+	return &ctx
+}
+
+// goflagsTags GOFLAGSから-tagsの値を取り出す
+func goflagsTags(goflags string) []string {
+	var tags []string
+	for _, flag := range strings.Fields(goflags) {
+		flag = strings.TrimPrefix(flag, "-")
+		flag = strings.TrimPrefix(flag, "-")
+		if !strings.HasPrefix(flag, "tags=") {
+			continue
+		}
+
+		tags = append(tags, strings.Split(strings.TrimPrefix(flag, "tags="), ",")...)
+	}
+
+	return tags
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"strings"
 
 	"github.com/YuuSatoh/implstub"
 	"github.com/urfave/cli/v2"
@@ -19,6 +20,64 @@ func main() {
 				Value:   "",
 				Usage:   "specify the output file path",
 			},
+			&cli.StringFlag{
+				Name:  "dest",
+				Usage: "choose the output file by convention: receiver, type-file (<type>.go) or a pattern such as {{.recv | snake}}_{{.iface | snake}}.go",
+			},
+			&cli.StringFlag{
+				Name:    "mode",
+				Aliases: []string{"m"},
+				Value:   "stub",
+				Usage:   "the kind of code to generate: stub, mock, gomock, delegate, log-decorator, sync-wrapper, multi, noop, func-adapter, unimplemented",
+			},
+			&cli.StringFlag{
+				Name:  "name",
+				Usage: "the name of the type generated by modes other than stub, or of the wrapper created by --wrap",
+			},
+			&cli.StringFlag{
+				Name:  "field",
+				Value: "next",
+				Usage: "the receiver field the delegate mode forwards calls to, added to the struct if missing",
+			},
+			&cli.StringFlag{
+				Name:  "logger",
+				Value: "slog",
+				Usage: "the logger of the log-decorator mode: slog or a type with Log(msg string, keyvals ...interface{}) such as Logger, logging.Logger or example.com/logging.Logger",
+			},
+			&cli.StringFlag{
+				Name:  "read-only",
+				Usage: "a comma-separated list of methods the sync-wrapper mode calls with RLock (or annotate them with // implstub:readonly)",
+			},
+			&cli.StringFlag{
+				Name:  "multi-error",
+				Value: "join",
+				Usage: "how the multi mode returns errors: join combines all of them with errors.Join, first stops at the first one",
+			},
+			&cli.BoolFlag{
+				Name:  "noop-var",
+				Usage: "make the type of the noop mode unexported and add a NoopXxx variable of the interface type",
+			},
+			&cli.BoolFlag{
+				Name:  "embed-unimplemented",
+				Usage: "embed UnimplementedXxxServer in the receiver of a gRPC XxxServer without asking",
+			},
+			&cli.BoolFlag{
+				Name:  "select-field",
+				Usage: "ask whether to delegate to a field implementing the interface even if stdin is not a terminal",
+			},
+			&cli.BoolFlag{
+				Name:  "force",
+				Usage: "generate without asking even if the code cannot satisfy the interface",
+			},
+			&cli.BoolFlag{
+				Name:  "wrap",
+				Usage: "create a wrapper type embedding the receiver without asking when --file is in another package (named by --name)",
+			},
+			&cli.StringFlag{
+				Name:  "generated",
+				Value: "redirect",
+				Usage: "what to do when the output file is generated (// Code generated ... DO NOT EDIT.): redirect writes to <type>_impl.go next to it, error stops",
+			},
 			&cli.BoolFlag{
 				Name:    "overwrite",
 				Aliases: []string{"w"},
@@ -29,15 +88,107 @@ func main() {
 				Aliases: []string{"p"},
 				Usage:   "create a stub with the pointer receiver",
 			},
+			&cli.StringFlag{
+				Name:  "interface-dir",
+				Usage: "search the interface under the directory instead of the argument",
+			},
+			&cli.StringFlag{
+				Name:  "receiver-dir",
+				Usage: "search the receiver under the directory instead of the argument",
+			},
+			&cli.StringFlag{
+				Name:  "new-type",
+				Usage: "create a new struct type with the name and implement the interface on it",
+			},
+			&cli.BoolFlag{
+				Name:  "constructor",
+				Usage: "add a NewXxx constructor to the created type",
+			},
+			&cli.BoolFlag{
+				Name:    "combined",
+				Aliases: []string{"c"},
+				Usage:   "select types from all packages in a single list without selecting a file",
+			},
+			&cli.BoolFlag{
+				Name:  "include-tests",
+				Usage: "include _test.go files in the selection",
+			},
+			&cli.StringSliceFlag{
+				Name:  "exclude",
+				Usage: "exclude files matching the glob from the selection (.gitignore syntax, repeatable)",
+			},
+			&cli.StringFlag{
+				Name:  "tags",
+				Usage: "a comma-separated list of build tags to consider satisfied",
+			},
+			&cli.StringFlag{
+				Name:  "goos",
+				Usage: "the target operating system used to load packages",
+			},
+			&cli.StringFlag{
+				Name:  "goarch",
+				Usage: "the target architecture used to load packages",
+			},
+			&cli.StringSliceFlag{
+				Name:  "env",
+				Usage: "an additional KEY=VALUE environment variable such as GOFLAGS (repeatable)",
+			},
+		},
+		Commands: []*cli.Command{
+			{
+				Name:  "undo",
+				Usage: "restore the files changed by the last run unless they have been modified since",
+				Action: func(c *cli.Context) error {
+					return implstub.Undo(".")
+				},
+			},
 		},
 		Action: func(c *cli.Context) error {
+			var tags []string
+			if c.String("tags") != "" {
+				tags = strings.Split(c.String("tags"), ",")
+			}
+			var readOnly []string
+			if c.String("read-only") != "" {
+				readOnly = strings.Split(c.String("read-only"), ",")
+			}
+
 			var f *string
 			argF := c.String("file")
 			if argF != "" {
 				f = &argF
 			}
 
-			return implstub.Exec(f, c.Bool("overwrite"), c.Bool("pointer"))
+			return implstub.Exec(&implstub.Options{
+				SrcPath:            c.Args().First(),
+				Output:             f,
+				Dest:               c.String("dest"),
+				Mode:               c.String("mode"),
+				Name:               c.String("name"),
+				Field:              c.String("field"),
+				Logger:             c.String("logger"),
+				ReadOnly:           readOnly,
+				MultiError:         c.String("multi-error"),
+				NoopVar:            c.Bool("noop-var"),
+				EmbedUnimplemented: c.Bool("embed-unimplemented"),
+				SelectField:        c.Bool("select-field"),
+				Force:              c.Bool("force"),
+				Wrap:               c.Bool("wrap"),
+				Generated:          c.String("generated"),
+				Overwrite:          c.Bool("overwrite"),
+				PointerReciever:    c.Bool("pointer"),
+				InterfaceDir:       c.String("interface-dir"),
+				ReceiverDir:        c.String("receiver-dir"),
+				NewType:            c.String("new-type"),
+				Constructor:        c.Bool("constructor"),
+				Combined:           c.Bool("combined"),
+				IncludeTests:       c.Bool("include-tests"),
+				Excludes:           c.StringSlice("exclude"),
+				Tags:               tags,
+				GOOS:               c.String("goos"),
+				GOARCH:             c.String("goarch"),
+				Env:                c.StringSlice("env"),
+			})
 		},
 	}
 
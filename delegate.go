@@ -0,0 +1,235 @@
+package implstub
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"text/template"
+
+	"github.com/ktr0731/go-fuzzyfinder"
+	"golang.org/x/term"
+)
+
+const delegateTemplate = `
+{{range .Methods}}
+// {{.Name}} delegates to {{$.Field}}.{{.Name}}.
+func ({{$.Recv}}) {{.Name}}{{.NamedSignature}} {
+	{{if .Results}}return {{end}}{{$.RecvName}}.{{$.Field}}.{{.Name}}({{.Args}})
+}
+{{end}}`
+
+var delegateTmpl = template.Must(template.New("delegate").Parse(delegateTemplate))
+
+// genDelegate レシーバーのフィールドに全てのメソッドの呼び出しを委譲する
+// フィールドが存在しない場合はインターフェース型のフィールドをレシーバーの構造体に追加する
+func genDelegate(g *genContext) ([]byte, error) {
+	field := g.opt.Field
+	if field == "" {
+		field = "next"
+	}
+
+	return genDelegateTo(g, field)
+}
+
+// genDelegateTo 実装済みでないメソッドの呼び出しをfieldに委譲する
+func genDelegateTo(g *genContext, field string) ([]byte, error) {
+	if !token.IsIdentifier(field) {
+		return nil, fmt.Errorf("invalid field name: %q", field)
+	}
+
+	obj, _, _ := types.LookupFieldOrMethod(g.recv.Type(), true, g.recv.Pkg(), field)
+	switch obj.(type) {
+	case nil:
+		if err := g.addRecvField(field, g.ifaceObj.Type()); err != nil {
+			return nil, err
+		}
+	case *types.Var:
+		if m := g.missingMethod(obj.Type()); m != nil {
+			return nil, fmt.Errorf("cannot delegate to %s.%s: %s does not implement %s (missing method %s)",
+				g.recv.Name(), field, types.TypeString(obj.Type(), types.RelativeTo(g.recv.Pkg())), g.ifaceObj.Name(), m.Name())
+		}
+	default:
+		return nil, fmt.Errorf("%s.%s is not a field", g.recv.Name(), field)
+	}
+
+	var methods []*methodInfo
+	for i := 0; i < g.iface.NumMethods(); i++ {
+		m := g.iface.Method(i)
+		if g.implemented(m) {
+			continue
+		}
+
+		methods = append(methods, g.r.method(m, g.decl.recvName))
+	}
+	if len(methods) == 0 {
+		return nil, nil
+	}
+
+	pointer := ""
+	if g.opt.PointerReciever {
+		pointer = "*"
+	}
+
+	return g.execute(delegateTmpl, map[string]interface{}{
+		"Recv":     fmt.Sprintf("%s %s%s", g.decl.recvName, pointer, g.recv.Name()),
+		"RecvName": g.decl.recvName,
+		"Field":    field,
+		"Methods":  methods,
+	})
+}
+
+// delegateCandidates レシーバーの構造体のフィールドのうち、型またはそのポインタがインターフェースを実装しているもの
+func (g *genContext) delegateCandidates() []*types.Var {
+	st, ok := g.recv.Type().Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+
+	var candidates []*types.Var
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		// UnimplementedXxxServerに委譲してもRPCは実装されない
+		if f.Name() == "_" || (g.grpcBase != nil && sameTypeName(f.Type(), g.grpcBase)) {
+			continue
+		}
+
+		if g.missingMethod(f.Type()) == nil {
+			candidates = append(candidates, f)
+		}
+	}
+
+	return candidates
+}
+
+// missingMethod typのフィールドに委譲した場合に足りないメソッドの1つ目。インターフェースを実装していればnilを返す
+// レシーバーのフィールドはアドレスを取れるため、ポインタレシーバーのメソッドも呼び出せる
+func (g *genContext) missingMethod(typ types.Type) *types.Func {
+	if _, ok := typ.Underlying().(*types.Interface); !ok {
+		if _, ok := typ.(*types.Pointer); !ok {
+			typ = types.NewPointer(typ)
+		}
+	}
+
+	m, _ := types.MissingMethod(typ, g.iface, true)
+	return m
+}
+
+// selectDelegateField インターフェースを実装しているフィールドがあれば、委譲するフィールドを選択させる
+// 委譲せずにスタブを生成する場合は空文字を返す
+// 標準入力が端末でない場合はOptions.SelectFieldを指定した場合のみ選択させる
+func (g *genContext) selectDelegateField() (string, error) {
+	// 全て実装済みの場合は委譲するものがない
+	if !g.missing() {
+		return "", nil
+	}
+	if !g.opt.SelectField && !term.IsTerminal(int(os.Stdin.Fd())) {
+		return "", nil
+	}
+
+	candidates := g.delegateCandidates()
+	if len(candidates) == 0 {
+		return "", nil
+	}
+
+	i, err := fuzzyfinder.Find(
+		append([]*types.Var{nil}, candidates...),
+		func(i int) string {
+			if i == 0 {
+				return "generate panic stubs"
+			}
+			f := candidates[i-1]
+			return fmt.Sprintf("delegate to %s (%s)", f.Name(), types.TypeString(f.Type(), types.RelativeTo(g.recv.Pkg())))
+		},
+		fuzzyfinder.WithPromptString(g.recv.Name()+" has fields implementing "+g.ifaceObj.Name()+" > "),
+	)
+	if err != nil {
+		return "", err
+	}
+	if i == 0 {
+		return "", nil
+	}
+
+	return candidates[i-1].Name(), nil
+}
+
+// addRecvField レシーバーの構造体の末尾にtyp型のnameフィールドを追加する
+// nameが空の場合は埋め込みフィールドとして構造体の先頭に追加する
+func (g *genContext) addRecvField(name string, typ types.Type) error {
+	var (
+		fileName  string
+		structTyp *ast.StructType
+	)
+	for _, syntax := range g.recvPkg.Syntax {
+		ast.Inspect(syntax, func(node ast.Node) bool {
+			t, ok := node.(*ast.TypeSpec)
+			if !ok || g.recvPkg.TypesInfo.Defs[t.Name] != g.recv {
+				return structTyp == nil
+			}
+
+			if st, ok := t.Type.(*ast.StructType); ok {
+				structTyp = st
+				fileName = g.recvPkg.Fset.Position(t.Pos()).Filename
+			}
+			return false
+		})
+	}
+	if structTyp == nil {
+		return fmt.Errorf("cannot add the field %s: %s is not a struct type", types.TypeString(typ, nil), g.recv.Name())
+	}
+
+	content, err := g.edits.read(fileName)
+	if err != nil {
+		return err
+	}
+	if isGenerated(fileName, content) {
+		return fmt.Errorf("cannot add the field %s: %s is declared in the generated file %s", types.TypeString(typ, nil), g.recv.Name(), fileName)
+	}
+
+	// 同じ実行で既に変更している場合に備えて、現在の内容から構造体の位置を求める
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fileName, content, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+	structTyp = nil
+	if obj := f.Scope.Lookup(g.recv.Name()); obj != nil {
+		if spec, ok := obj.Decl.(*ast.TypeSpec); ok {
+			structTyp, _ = spec.Type.(*ast.StructType)
+		}
+	}
+	if structTyp == nil {
+		return fmt.Errorf("%s is not found in %s", g.recv.Name(), fileName)
+	}
+
+	// フィールドの型は構造体を宣言したファイルのimportで参照する
+	r := newTypeRenderer(g.recv.Pkg(), syntaxOf(g.recvPkg, fileName))
+	decl := fmt.Sprintf("\t%s %s\n", name, r.typeString(typ))
+	offset := fset.Position(structTyp.Fields.Closing).Offset
+	if name == "" {
+		decl = fmt.Sprintf("\n\t%s\n", r.typeString(typ))
+		offset = fset.Position(structTyp.Fields.Opening).Offset + 1
+	} else if offset == 0 || content[offset-1] != '\n' {
+		decl = "\n" + decl
+	}
+
+	src := make([]byte, 0, len(content)+len(decl))
+	src = append(src, content[:offset]...)
+	src = append(src, decl...)
+	src = append(src, content[offset:]...)
+
+	src, err = addImports(fileName, src, r.added)
+	if err != nil {
+		return err
+	}
+
+	pretty, err := format.Source(src)
+	if err != nil {
+		return fmt.Errorf("failed to format %s: %w", fileName, err)
+	}
+
+	return g.edits.set(fileName, pretty)
+}
@@ -0,0 +1,72 @@
+package implstub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// destFuncs Options.Destのパターンで使える関数
+var destFuncs = template.FuncMap{
+	"snake": snakeCase,
+	"lower": strings.ToLower,
+}
+
+// resolveDest Options.Destから書き出し先のファイルを決める
+// receiverは既存のファイル、type-fileはdirの<型名>.go、それ以外はdirからの相対パスのパターンとして扱う
+// パターンでは{{.recv}}、{{.iface}}、{{.mode}}と、関数snake、lowerが使える
+func resolveDest(opt *Options, file, dir, typeName string) (string, error) {
+	if opt.Output != nil || opt.Overwrite {
+		return "", errors.New("--dest cannot be used with --file or --overwrite")
+	}
+
+	mode := opt.Mode
+	if mode == "" {
+		mode = "stub"
+	}
+
+	switch opt.Dest {
+	case "receiver":
+		return file, nil
+	case "type-file":
+		if typeName == "" {
+			return "", fmt.Errorf("the name of the type generated by the %s mode is unknown, specify --name", mode)
+		}
+		return filepath.Join(dir, snakeCase(typeName)+".go"), nil
+	}
+
+	tmpl, err := template.New("dest").Funcs(destFuncs).Option("missingkey=error").Parse(opt.Dest)
+	if err != nil {
+		return "", fmt.Errorf("invalid dest pattern: %w", err)
+	}
+
+	data := map[string]string{
+		"iface": detectedInterface.Name,
+		"mode":  mode,
+	}
+	// 型の名前がわからない場合に{{.recv}}を使うと空文字ではなくエラーにする
+	if typeName != "" {
+		data["recv"] = typeName
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		if typeName == "" {
+			return "", fmt.Errorf("invalid dest pattern: %w (the name of the type generated by the %s mode is unknown, specify --name)", err, mode)
+		}
+		return "", fmt.Errorf("invalid dest pattern: %w", err)
+	}
+
+	dst := buf.String()
+	if filepath.Ext(dst) != ".go" {
+		return "", fmt.Errorf("the dest pattern %s must name a .go file: %s", opt.Dest, dst)
+	}
+	if !filepath.IsAbs(dst) {
+		dst = filepath.Join(dir, dst)
+	}
+
+	return dst, nil
+}
@@ -1,28 +1,41 @@
 package implstub
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
+	"go/format"
 	"go/parser"
+	"go/printer"
 	"go/token"
+	"go/types"
 	"io/fs"
+	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/ktr0731/go-fuzzyfinder"
 	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
 )
 
 type Result struct {
 	Name     string
 	FilePath string
+	// Created 選択ではなく新しく作成した型の場合true
+	Created bool
+	// edits 新しく作成した型の宣言。Generateで生成したコードと一緒に書き出す
+	edits *fileEdits
 }
 
-func DetectReciever(srcPath string) (*Result, error) {
-	fileNames, err := findFilesWithWalkDir(srcPath)
+func DetectReciever(srcPath string, opt *Options) (*Result, error) {
+	fileNames, err := FindGoFiles(srcPath, opt)
 	if err != nil {
 		return nil, err
 	}
+	if len(fileNames) == 0 {
+		return nil, fmt.Errorf("no go files found in %s", srcPath)
+	}
 
 	fileName := fileNames[0]
 	if len(fileNames) > 1 {
@@ -39,11 +52,13 @@ func DetectReciever(srcPath string) (*Result, error) {
 		fileName = fileNames[i]
 	}
 
-	// 現状レシーバーの選択対象は構造体のみ
-	sts, err := getStructTypes(fileName)
+	// インターフェース以外のパッケージ内で定義された型をレシーバーの選択対象にする
+	sts, err := getReceiverTypes(fileName)
 	if err != nil {
 		return nil, err
 	}
+	// 実装する型がまだない場合に選択したファイルへ新しく作成できるようにする
+	sts = append(sts, newTypeSpec)
 	i, err := fuzzyfinder.Find(
 		sts,
 		func(i int) string {
@@ -54,39 +69,65 @@ func DetectReciever(srcPath string) (*Result, error) {
 				return ""
 			}
 
-			it, ok := sts[i].Type.(*ast.StructType)
-			if !ok {
-				return ""
-			}
-
-			str := fmt.Sprintf("type %s struct {\n", sts[i].Name.String())
-			for _, field := range it.Fields.List {
-				comment := field.Comment.Text()
-				if comment != "" {
-					str += comment + "\n"
-				}
-
-				str += fmt.Sprintf("\t%s\n", prettyMethodParam(field))
-			}
-
-			return str + "}"
+			return receiverPreview(sts[i], fileName)
 		}),
 	)
 	if err != nil {
 		return nil, err
 	}
 
+	if sts[i] == newTypeSpec {
+		name, err := promptLine("new type name: ")
+		if err != nil {
+			return nil, err
+		}
+
+		return createType(fileName, name, opt)
+	}
+
 	return &Result{
 		Name:     sts[i].Name.String(),
 		FilePath: fileName,
 	}, nil
 }
 
-func DetectInterface(srcPath string) (*Result, error) {
-	fileNames, err := findFilesWithWalkDir(srcPath)
+// receiverPreview レシーバーの一覧のプレビューに表示する型宣言
+func receiverPreview(spec *ast.TypeSpec, fileName string) string {
+	if spec == newTypeSpec {
+		return fmt.Sprintf("create a new struct type in %s", fileName)
+	}
+
+	it, ok := spec.Type.(*ast.StructType)
+	if !ok {
+		// 構造体以外は元になる型を表示する
+		assign := ""
+		if spec.Assign.IsValid() {
+			assign = "= "
+		}
+		return fmt.Sprintf("type %s %s%s", spec.Name.String(), assign, types.ExprString(spec.Type))
+	}
+
+	str := fmt.Sprintf("type %s struct {\n", spec.Name.String())
+	for _, field := range it.Fields.List {
+		comment := field.Comment.Text()
+		if comment != "" {
+			str += comment + "\n"
+		}
+
+		str += fmt.Sprintf("\t%s\n", prettyMethodParam(field))
+	}
+
+	return str + "}"
+}
+
+func DetectInterface(srcPath string, opt *Options) (*Result, error) {
+	fileNames, err := FindGoFiles(srcPath, opt)
 	if err != nil {
 		return nil, err
 	}
+	if len(fileNames) == 0 {
+		return nil, fmt.Errorf("no go files found in %s", srcPath)
+	}
 
 	fileName := fileNames[0]
 	if len(fileNames) > 1 {
@@ -239,7 +280,7 @@ func getInterfaceTypes(filename string) ([]*ast.TypeSpec, error) {
 	return genInterfaces, nil
 }
 
-func getStructTypes(filename string) ([]*ast.TypeSpec, error) {
+func getReceiverTypes(filename string) ([]*ast.TypeSpec, error) {
 	// ファイルごとのトークンの位置を記録する
 	fset := token.NewFileSet()
 
@@ -266,8 +307,7 @@ func getStructTypes(filename string) ([]*ast.TypeSpec, error) {
 				continue
 			}
 
-			_, ok = t.Type.(*ast.StructType)
-			if !ok {
+			if !isReceiverSpec(t) {
 				continue
 			}
 
@@ -280,15 +320,101 @@ func getStructTypes(filename string) ([]*ast.TypeSpec, error) {
 	return genInterfaces, nil
 }
 
-func findFilesWithWalkDir(root string) ([]string, error) {
-	findList := []string{}
+// isReceiverSpec メソッドを定義できる型宣言か判定する
+// インターフェースとポインタ型はレシーバーにできず、エイリアスは同じパッケージの型を指すもののみ対象にする
+func isReceiverSpec(t *ast.TypeSpec) bool {
+	switch typ := t.Type.(type) {
+	case *ast.InterfaceType, *ast.StarExpr:
+		return false
+	case *ast.Ident:
+		if t.Assign.IsValid() && types.Universe.Lookup(typ.Name) != nil {
+			return false
+		}
+	default:
+		if t.Assign.IsValid() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FindGoFiles root以下からスタブ生成の対象となるGoファイルを探す
+// vendor, testdata, node_modules, 隠しディレクトリと.gitignoreに一致するものは除外する
+func FindGoFiles(root string, opt *Options) ([]string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := parentGitignores(absRoot)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := opt.buildContext()
+
+	// 明示的に指定された除外は.gitignoreの否定パターンより優先する
+	var excludes ignoreRules
+	for _, pattern := range opt.Excludes {
+		r, err := newIgnoreRule(absRoot, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			excludes = append(excludes, r)
+		}
+	}
 
-	err := filepath.WalkDir(root, func(path string, info fs.DirEntry, err error) error {
+	// ディレクトリごとに読み込んだ.gitignoreのルール
+	dirRules := map[string]ignoreRules{}
+
+	findList := []string{}
+	err = filepath.WalkDir(root, func(path string, info fs.DirEntry, err error) error {
 		if err != nil {
 			return errors.Wrap(err, "failed filepath.WalkDir")
 		}
 
-		if info.IsDir() || (strings.HasPrefix(path, ".") && !strings.HasPrefix(path, "./")) {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return err
+		}
+
+		name := info.Name()
+		if info.IsDir() {
+			if absPath != absRoot {
+				if name == "vendor" || name == "testdata" || name == "node_modules" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+					return filepath.SkipDir
+				}
+				if excludes.ignored(absPath, true) || dirRules[filepath.Dir(absPath)].ignored(absPath, true) {
+					return filepath.SkipDir
+				}
+			}
+
+			rs, err := readGitignore(absPath)
+			if err != nil {
+				return err
+			}
+			parent := rules
+			if absPath != absRoot {
+				parent = dirRules[filepath.Dir(absPath)]
+			}
+			dirRules[absPath] = append(append(ignoreRules{}, parent...), rs...)
+
+			return nil
+		}
+
+		if filepath.Ext(name) != ".go" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") {
+			return nil
+		}
+		if !opt.IncludeTests && strings.HasSuffix(name, "_test.go") {
+			return nil
+		}
+		if excludes.ignored(absPath, false) || dirRules[filepath.Dir(absPath)].ignored(absPath, false) {
+			return nil
+		}
+		// ビルド制約で除外されるファイルは選択しても型を読み込めない
+		if ok, err := ctx.MatchFile(filepath.Dir(path), name); err != nil || !ok {
 			return nil
 		}
 
@@ -297,3 +423,152 @@ func findFilesWithWalkDir(root string) ([]string, error) {
 	})
 	return findList, err
 }
+
+// typeDecl パッケージ横断の一覧に表示する型宣言
+type typeDecl struct {
+	pkgName  string
+	spec     *ast.TypeSpec
+	file     *ast.File
+	fset     *token.FileSet
+	position token.Position
+}
+
+// DetectInterfaceFromPackages srcPath以下の全パッケージのインターフェースを一覧にして選択する
+func DetectInterfaceFromPackages(srcPath string, opt *Options) (*Result, error) {
+	return detectFromPackages(srcPath, opt, func(t *ast.TypeSpec) bool {
+		_, ok := t.Type.(*ast.InterfaceType)
+		return ok
+	})
+}
+
+// DetectRecieverFromPackages srcPath以下の全パッケージのレシーバーになれる型を一覧にして選択する
+func DetectRecieverFromPackages(srcPath string, opt *Options) (*Result, error) {
+	return detectFromPackages(srcPath, opt, isReceiverSpec)
+}
+
+func detectFromPackages(srcPath string, opt *Options, match func(*ast.TypeSpec) bool) (*Result, error) {
+	decls, err := indexTypeDecls(srcPath, opt, match)
+	if err != nil {
+		return nil, err
+	}
+	if len(decls) == 0 {
+		return nil, fmt.Errorf("no type found in %s", srcPath)
+	}
+
+	i, err := fuzzyfinder.Find(
+		decls,
+		func(i int) string {
+			return decls[i].label()
+		},
+		fuzzyfinder.WithPreviewWindow(func(i, w, h int) string {
+			if i == -1 {
+				return ""
+			}
+
+			return decls[i].source()
+		}),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Name:     decls[i].spec.Name.String(),
+		FilePath: decls[i].position.Filename,
+	}, nil
+}
+
+// indexTypeDecls srcPath以下のパッケージを読み込みmatchに一致する型宣言を集める
+func indexTypeDecls(srcPath string, opt *Options, match func(*ast.TypeSpec) bool) ([]*typeDecl, error) {
+	// ファイル単位の選択と同じ除外ルールを適用する
+	fileNames, err := FindGoFiles(srcPath, opt)
+	if err != nil {
+		return nil, err
+	}
+	allowed := make(map[string]struct{}, len(fileNames))
+	for _, fileName := range fileNames {
+		absPath, err := filepath.Abs(fileName)
+		if err != nil {
+			return nil, err
+		}
+		allowed[absPath] = struct{}{}
+	}
+
+	fset := token.NewFileSet()
+	config := opt.packagesConfig(packages.NeedName | packages.NeedFiles | packages.NeedSyntax)
+	config.Dir = srcPath
+	config.Fset = fset
+	config.Tests = opt.IncludeTests
+
+	pkgs, err := packages.Load(config, "./...")
+	if err != nil {
+		return nil, errors.Wrap(err, "failed packages.Load")
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+
+	var decls []*typeDecl
+	// テストを含める場合は同じファイルが通常のパッケージとテスト用のパッケージの両方に含まれる
+	seen := make(map[token.Position]bool)
+	for _, pkg := range pkgs {
+		for _, f := range pkg.Syntax {
+			for _, d := range f.Decls {
+				genDecl, ok := d.(*ast.GenDecl)
+				if !ok || genDecl.Tok != token.TYPE {
+					continue
+				}
+
+				for _, spec := range genDecl.Specs {
+					t, ok := spec.(*ast.TypeSpec)
+					if !ok || !match(t) {
+						continue
+					}
+
+					position := fset.Position(t.Pos())
+					if _, ok := allowed[position.Filename]; !ok || seen[position] {
+						continue
+					}
+					seen[position] = true
+					// 一覧で見やすいようにカレントディレクトリからの相対パスにする
+					if rel, err := filepath.Rel(wd, position.Filename); err == nil {
+						position.Filename = rel
+					}
+
+					decls = append(decls, &typeDecl{
+						pkgName:  pkg.Name,
+						spec:     t,
+						file:     f,
+						fset:     fset,
+						position: position,
+					})
+				}
+			}
+		}
+	}
+
+	return decls, nil
+}
+
+// label 一覧に表示する「パッケージ名.型名 — ファイル:行」の形式の名前
+func (d *typeDecl) label() string {
+	return fmt.Sprintf("%s.%s — %s:%d", d.pkgName, d.spec.Name, d.position.Filename, d.position.Line)
+}
+
+// source プレビュー用に型宣言をコメントごと整形して返す
+func (d *typeDecl) source() string {
+	decl := &ast.GenDecl{
+		Tok:    token.TYPE,
+		TokPos: d.spec.Pos(),
+		Specs:  []ast.Spec{d.spec},
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, d.fset, &printer.CommentedNode{Node: decl, Comments: d.file.Comments}); err != nil {
+		return err.Error()
+	}
+
+	return buf.String()
+}
@@ -0,0 +1,169 @@
+package implstub
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+
+	"golang.org/x/tools/go/ast/astutil"
+)
+
+// fileEdits 書き出す前のファイルの内容を保持し、最後にまとめて書き出す
+// 同じファイルへの複数の変更は前の変更の結果に積み重ねる
+type fileEdits struct {
+	contents map[string][]byte
+	// order 変更した順に書き出すためのファイル名
+	order []string
+}
+
+func newFileEdits() *fileEdits {
+	return &fileEdits{contents: make(map[string][]byte)}
+}
+
+// read 変更済みの内容があればそれを、なければディスク上の内容を返す
+// ファイルが存在しない場合はnilを返す
+func (e *fileEdits) read(fileName string) ([]byte, error) {
+	absPath, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if content, ok := e.contents[absPath]; ok {
+		return content, nil
+	}
+
+	content, err := os.ReadFile(absPath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+
+	return content, err
+}
+
+// set fileNameの内容を置き換える
+func (e *fileEdits) set(fileName string, content []byte) error {
+	absPath, err := filepath.Abs(fileName)
+	if err != nil {
+		return err
+	}
+
+	if _, ok := e.contents[absPath]; !ok {
+		e.order = append(e.order, absPath)
+	}
+	e.contents[absPath] = content
+
+	return nil
+}
+
+// appendSource fileNameの末尾にsrcを追記し、importsをimport宣言に追加する
+// fileNameが存在しないかGoのソースとして解釈できない場合はsrcをそのまま追記する
+func (e *fileEdits) appendSource(fileName string, src []byte, imports map[string]string) error {
+	content, err := e.read(fileName)
+	if err != nil {
+		return err
+	}
+
+	content, err = addImports(fileName, content, imports)
+	if err != nil {
+		return err
+	}
+
+	// 既存の宣言とスタブの間は1行空ける
+	if len(content) > 0 && len(src) > 0 && !bytes.HasSuffix(content, []byte("\n\n")) {
+		content = append(bytes.TrimRight(content, "\n"), '\n', '\n')
+	}
+
+	return e.set(fileName, append(content, src...))
+}
+
+// clone 同じ変更を持つコピー。書き出さずに追加の変更を試すときに使う
+func (e *fileEdits) clone() *fileEdits {
+	c := newFileEdits()
+	for _, fileName := range e.order {
+		c.order = append(c.order, fileName)
+		c.contents[fileName] = e.contents[fileName]
+	}
+
+	return c
+}
+
+// flush 変更前の内容を記録してから、変更したファイルをそれぞれ置き換えて書き出す
+// 既存のファイルはパーミッションを引き継ぐ
+func (e *fileEdits) flush() error {
+	if err := e.record(); err != nil {
+		return err
+	}
+
+	for _, fileName := range e.order {
+		if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+			return err
+		}
+
+		perm := os.FileMode(0644)
+		if info, err := os.Stat(fileName); err == nil {
+			perm = info.Mode().Perm()
+		}
+
+		if err := writeFileAtomic(fileName, e.contents[fileName], perm); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// addImports contentのimport宣言にimportsを追加する。Goのソースとして解釈できない場合はそのまま返す
+func addImports(fileName string, content []byte, imports map[string]string) ([]byte, error) {
+	if len(imports) == 0 {
+		return content, nil
+	}
+
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, fileName, content, parser.ParseComments)
+	if err != nil {
+		return content, nil
+	}
+
+	for importPath, name := range imports {
+		astutil.AddNamedImport(fset, f, name, importPath)
+	}
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, f); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// output dstが空の場合はOptions.Stdoutに、そうでなければdstのファイルにsrcを追記する
+// dstが存在しない場合はpkgのパッケージ宣言から始まるファイルを作成する
+func output(opt *Options, edits *fileEdits, dst string, pkg *types.Package, src []byte, r *typeRenderer) error {
+	if dst == "" {
+		var w io.Writer = os.Stdout
+		if opt.Stdout != nil {
+			w = opt.Stdout
+		}
+
+		_, err := w.Write(src)
+		return err
+	}
+
+	content, err := edits.read(dst)
+	if err != nil {
+		return err
+	}
+	if content == nil {
+		if err := edits.set(dst, []byte(fmt.Sprintf("package %s\n", pkg.Name()))); err != nil {
+			return err
+		}
+	}
+
+	return edits.appendSource(dst, src, r.added)
+}
@@ -0,0 +1,58 @@
+package implstub
+
+import (
+	"bufio"
+	"go/ast"
+	"io"
+)
+
+// TypeDeclLabels パッケージ横断の一覧に表示する名前を、fuzzyfinderを使わずに取得する
+func TypeDeclLabels(srcPath string, opt *Options, interfaces bool) ([]string, error) {
+	match := isReceiverSpec
+	if interfaces {
+		match = func(t *ast.TypeSpec) bool {
+			_, ok := t.Type.(*ast.InterfaceType)
+			return ok
+		}
+	}
+
+	decls, err := indexTypeDecls(srcPath, opt, match)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make([]string, 0, len(decls))
+	for _, d := range decls {
+		labels = append(labels, d.label())
+	}
+
+	return labels, nil
+}
+
+// PackageOf 読み込んだパッケージからfileNameを含むものを探す
+var PackageOf = packageOf
+
+// ReceiverPreviews fileNameのレシーバーにできる型のプレビューを、fuzzyfinderを使わずに型名ごとに取得する
+func ReceiverPreviews(fileName string) (map[string]string, error) {
+	sts, err := getReceiverTypes(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	previews := make(map[string]string, len(sts))
+	for _, spec := range sts {
+		previews[spec.Name.Name] = receiverPreview(spec, fileName)
+	}
+
+	return previews, nil
+}
+
+// PromptLine 標準入力から1行読み込む
+var PromptLine = promptLine
+
+// SetStdin promptLineが読み込む標準入力をrに置き換え、元に戻す関数を返す
+func SetStdin(r io.Reader) func() {
+	orig := stdin
+	stdin = bufio.NewReader(r)
+	return func() { stdin = orig }
+}
@@ -0,0 +1,60 @@
+package implstub
+
+import (
+	"text/template"
+)
+
+const funcAdapterTemplate = `
+{{- with index .Methods 0}}
+// {{$.Name}} is an adapter to allow the use of an ordinary function as a {{$.IfaceName}}.
+type {{$.Name}} {{.FuncType}}
+
+var _ {{$.Iface}} = {{$.Name}}(nil)
+
+// {{.Name}} calls f({{.Args}}).
+func (f {{$.Name}}) {{.Name}}{{.Signature}} {
+	{{if .Results}}return {{end}}f({{.Args}})
+}
+{{end}}`
+
+const funcsAdapterTemplate = `
+// {{.Name}} is an adapter to implement {{.IfaceName}} with a function for each method.
+type {{.Name}} struct {
+{{- range .Methods}}
+	{{.Exported}}Func {{.FuncType}}
+{{- end}}
+}
+
+var _ {{.Iface}} = {{.Name}}{}
+{{range .Methods}}
+// {{.Name}} calls {{.Exported}}Func.
+func (f {{$.Name}}) {{.Name}}{{.Signature}} {
+	{{if .Results}}return {{end}}f.{{.Exported}}Func({{.Args}})
+}
+{{end}}`
+
+var (
+	funcAdapterTmpl  = template.Must(template.New("funcAdapter").Parse(funcAdapterTemplate))
+	funcsAdapterTmpl = template.Must(template.New("funcsAdapter").Parse(funcsAdapterTemplate))
+)
+
+// genFuncAdapter メソッドが1つのインターフェースはhttp.HandlerFuncのような関数型を、
+// 複数のインターフェースはメソッドごとの関数フィールドを持つ構造体を生成する
+func genFuncAdapter(g *genContext) ([]byte, error) {
+	methods := g.methods("f")
+	if len(methods) == 1 {
+		return g.execute(funcAdapterTmpl, map[string]interface{}{
+			"Name":      g.typeName("%sFunc"),
+			"Iface":     g.ifaceName(),
+			"IfaceName": g.ifaceObj.Name(),
+			"Methods":   methods,
+		})
+	}
+
+	return g.execute(funcsAdapterTmpl, map[string]interface{}{
+		"Name":      g.typeName("%sFuncs"),
+		"Iface":     g.ifaceName(),
+		"IfaceName": g.ifaceObj.Name(),
+		"Methods":   methods,
+	})
+}
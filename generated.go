@@ -0,0 +1,70 @@
+package implstub
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// isGenerated contentがパッケージ宣言より前に「// Code generated ... DO NOT EDIT.」の行を持つ生成されたファイルか
+// go 1.21のast.IsGeneratedと同じ規則で判定する
+func isGenerated(fileName string, content []byte) bool {
+	f, err := parser.ParseFile(token.NewFileSet(), fileName, content, parser.PackageClauseOnly|parser.ParseComments)
+	if err != nil {
+		return false
+	}
+
+	const prefix = "// Code generated "
+	for _, group := range f.Comments {
+		for _, comment := range group.List {
+			if comment.Pos() > f.Package {
+				return false
+			}
+			if !strings.Contains(comment.Text, prefix) {
+				continue
+			}
+			for _, line := range strings.Split(comment.Text, "\n") {
+				if strings.HasPrefix(line, prefix) && strings.HasSuffix(line, " DO NOT EDIT.") {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// checkGenerated dstが生成されたファイルの場合、再生成で変更が失われないように同じディレクトリの<型名>_impl.goに書き出し先を変える
+// Options.Generatedがerrorの場合は書き出し先を変えずにエラーを返す
+func checkGenerated(opt *Options, edits *fileEdits, dst, typeName string) (string, error) {
+	content, err := edits.read(dst)
+	if err != nil {
+		return "", err
+	}
+	if content == nil || !isGenerated(dst, content) {
+		return dst, nil
+	}
+
+	switch opt.Generated {
+	case "", "redirect":
+	case "error":
+		return "", fmt.Errorf("%s is a generated file and the changes would be lost on regeneration", dst)
+	default:
+		return "", fmt.Errorf("unknown generated: %s", opt.Generated)
+	}
+
+	sibling := filepath.Join(filepath.Dir(dst), snakeCase(typeName)+"_impl.go")
+	content, err = edits.read(sibling)
+	if err != nil {
+		return "", err
+	}
+	if content != nil && isGenerated(sibling, content) {
+		return "", fmt.Errorf("%s and %s are generated files", dst, sibling)
+	}
+
+	fmt.Fprintf(os.Stderr, "%s is a generated file, writing to %s instead\n", dst, sibling)
+	return sibling, nil
+}
@@ -6,6 +6,7 @@ require (
 	github.com/ktr0731/go-fuzzyfinder v0.5.1
 	github.com/pkg/errors v0.9.1
 	github.com/urfave/cli/v2 v2.3.0
+	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf
 	golang.org/x/tools v0.1.9
 )
 
@@ -21,7 +22,6 @@ require (
 	github.com/shurcooL/sanitized_anchor_name v1.0.0 // indirect
 	golang.org/x/mod v0.5.1 // indirect
 	golang.org/x/sys v0.0.0-20211019181941-9d821ace8654 // indirect
-	golang.org/x/term v0.0.0-20201210144234-2321bbc49cbf // indirect
 	golang.org/x/text v0.3.7 // indirect
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 )
@@ -0,0 +1,112 @@
+package implstub
+
+import (
+	"fmt"
+	"text/template"
+)
+
+const gomockTemplate = `
+// {{.Name}} is a mock of {{.IfaceName}} interface.
+type {{.Name}} struct {
+	ctrl     *{{.Gomock}}.Controller
+	recorder *{{.Name}}MockRecorder
+}
+
+// {{.Name}}MockRecorder is the mock recorder for {{.Name}}.
+type {{.Name}}MockRecorder struct {
+	mock *{{.Name}}
+}
+
+// New{{.Name}} creates a new mock instance.
+func New{{.Name}}(ctrl *{{.Gomock}}.Controller) *{{.Name}} {
+	mock := &{{.Name}}{ctrl: ctrl}
+	mock.recorder = &{{.Name}}MockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *{{.Name}}) EXPECT() *{{.Name}}MockRecorder {
+	return m.recorder
+}
+{{range .Methods}}
+// {{.Name}} mocks base method.
+func (m *{{$.Name}}) {{.Name}}{{.Signature}} {
+	m.ctrl.T.Helper()
+{{- if .Variadic}}
+	varargs := []interface{}{ {{- fixedArgs .}}}
+	for _, a := range {{variadicArg .}} {
+		varargs = append(varargs, a)
+	}
+	{{if .Results}}ret := {{end}}m.ctrl.Call(m, "{{.Name}}", varargs...)
+{{- else}}
+	{{if .Results}}ret := {{end}}m.ctrl.Call(m, "{{.Name}}"{{range .Params}}, {{.Name}}{{end}})
+{{- end}}
+{{- range $i, $r := .Results}}
+	ret{{$i}}, _ := ret[{{$i}}].({{$r}})
+{{- end}}
+{{- if .Results}}
+	return {{range $i, $r := .Results}}{{if $i}}, {{end}}ret{{$i}}{{end}}
+{{- end}}
+}
+
+// {{.Name}} indicates an expected call of {{.Name}}.
+func (mr *{{$.Name}}MockRecorder) {{.Name}}({{recorderParams .}}) *{{$.Gomock}}.Call {
+	mr.mock.ctrl.T.Helper()
+{{- if .Variadic}}
+	varargs := append([]interface{}{ {{- fixedArgs .}}}, {{variadicArg .}}...)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "{{.Name}}", {{$.Reflect}}.TypeOf((*{{$.Name}})(nil).{{.Name}}), varargs...)
+{{- else}}
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "{{.Name}}", {{$.Reflect}}.TypeOf((*{{$.Name}})(nil).{{.Name}}){{range .Params}}, {{.Name}}{{end}})
+{{- end}}
+}
+{{end}}`
+
+var gomockTmpl = template.Must(template.New("gomock").Funcs(template.FuncMap{
+	// fixedArgs 可変長引数より前の引数
+	"fixedArgs": func(m *methodInfo) string {
+		args := ""
+		for i, p := range m.Params[:len(m.Params)-1] {
+			if i > 0 {
+				args += ", "
+			}
+			args += p.Name
+		}
+		return args
+	},
+	"variadicArg": func(m *methodInfo) string {
+		return m.Params[len(m.Params)-1].Name
+	},
+	// recorderParams レコーダーは任意の値やMatcherを受け取れるようにinterface{}で受ける
+	"recorderParams": func(m *methodInfo) string {
+		params := ""
+		for i, p := range m.Params {
+			if i > 0 {
+				params += ", "
+			}
+			typ := "interface{}"
+			if m.Variadic && i == len(m.Params)-1 {
+				typ = "...interface{}"
+			}
+			params += p.Name + " " + typ
+		}
+		return params
+	},
+}).Parse(gomockTemplate))
+
+// genGomock github.com/golang/mock/gomockのコントローラーで使うモックを生成する
+// mockgenの出力と同じ構成にし、implstub自身はgomockに依存しない
+func genGomock(g *genContext) ([]byte, error) {
+	// 生成するコードで使う変数名と引数名が重ならないようにする
+	reserved := []string{"m", "mr", "ret", "varargs", "a"}
+	for i := 0; i < g.maxResults(); i++ {
+		reserved = append(reserved, fmt.Sprintf("ret%d", i))
+	}
+
+	return g.execute(gomockTmpl, map[string]interface{}{
+		"Name":      g.typeName("Mock%s"),
+		"IfaceName": g.ifaceObj.Name(),
+		"Gomock":    g.importName("github.com/golang/mock/gomock", "gomock"),
+		"Reflect":   g.importName("reflect", "reflect"),
+		"Methods":   g.methods(reserved...),
+	})
+}
@@ -0,0 +1,109 @@
+package implstub
+
+import (
+	"fmt"
+	"go/types"
+	"io"
+	"strings"
+)
+
+// mustEmbedPrefix gRPCの生成コードがXxxServerに追加する、UnimplementedXxxServerの埋め込みを強制するメソッドの接頭辞
+const mustEmbedPrefix = "mustEmbedUnimplemented"
+
+// grpcUnimplemented インターフェースがgRPCのXxxServerの形をしていれば、同じパッケージのUnimplementedXxxServerを返す
+func (g *genContext) grpcUnimplemented() *types.TypeName {
+	name := g.ifaceObj.Name()
+
+	found := false
+	for i := 0; i < g.iface.NumMethods(); i++ {
+		if g.iface.Method(i).Name() == mustEmbedPrefix+name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil
+	}
+
+	base, ok := g.ifaceObj.Pkg().Scope().Lookup("Unimplemented" + name).(*types.TypeName)
+	if !ok {
+		return nil
+	}
+	if _, ok := base.Type().Underlying().(*types.Struct); !ok {
+		return nil
+	}
+
+	return base
+}
+
+// prepareGRPC gRPCのXxxServerであれば、UnimplementedXxxServerをレシーバーに埋め込むか確認する
+// 埋め込んだ場合や既に埋め込まれている場合は、RPCのメソッドだけをスタブの対象にする
+func (g *genContext) prepareGRPC() error {
+	base := g.grpcUnimplemented()
+	if base == nil {
+		return nil
+	}
+	g.grpcBase = base
+
+	if embeds(g.recv.Type(), base) {
+		return nil
+	}
+	if _, ok := g.recv.Type().Underlying().(*types.Struct); !ok {
+		return nil
+	}
+
+	embed := g.opt.EmbedUnimplemented
+	if !embed {
+		answer, err := promptLine(fmt.Sprintf("embed %s in %s and stub only the RPC methods? [y/N]: ", types.TypeString(base.Type(), types.RelativeTo(g.recv.Pkg())), g.recv.Name()))
+		if err != nil && err != io.EOF {
+			return err
+		}
+		embed = strings.EqualFold(answer, "y") || strings.EqualFold(answer, "yes")
+	}
+	if !embed {
+		return nil
+	}
+
+	if err := g.addRecvField("", base.Type()); err != nil {
+		return err
+	}
+	g.embedsGRPCBase = true
+
+	return nil
+}
+
+// embeds tの構造体がbaseを直接埋め込んでいるか
+func embeds(t types.Type, base *types.TypeName) bool {
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return false
+	}
+
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if f.Embedded() && sameTypeName(f.Type(), base) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sameTypeName tもしくはそのポインタの要素がobjの型か。別々に読み込んだパッケージでも比較できるようにパスと名前で比べる
+func sameTypeName(t types.Type, obj *types.TypeName) bool {
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+
+	named, ok := t.(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || obj.Pkg() == nil {
+		return false
+	}
+
+	return named.Obj().Name() == obj.Name() && named.Obj().Pkg().Path() == obj.Pkg().Path()
+}
+
+// foreignUnexported 別のパッケージのインターフェースの非公開メソッドで、出力先のパッケージでは実装できないものか
+func (g *genContext) foreignUnexported(m *types.Func) bool {
+	return !m.Exported() && m.Pkg() != nil && g.r.pkg != nil && m.Pkg().Path() != g.r.pkg.Path()
+}
@@ -0,0 +1,187 @@
+package implstub
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ignoreRule .gitignoreや--excludeで指定された1つのパターン
+type ignoreRule struct {
+	// base パターンの基準となるディレクトリ
+	base    string
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+	// anchored スラッシュを含むパターンはbaseからの相対パスで照合する
+	anchored bool
+}
+
+// newIgnoreRule gitignoreの書式でパターンを解釈する。空行やコメントの場合はnilを返す
+func newIgnoreRule(base, pattern string) (*ignoreRule, error) {
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if pattern == "" || strings.HasPrefix(pattern, "#") {
+		return nil, nil
+	}
+
+	r := &ignoreRule{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		r.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		r.dirOnly = true
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	if strings.Contains(pattern, "/") {
+		r.anchored = true
+		pattern = strings.TrimPrefix(pattern, "/")
+	}
+
+	re, err := regexp.Compile("^" + globToRegexp(pattern) + "$")
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid pattern %q", pattern)
+	}
+	r.re = re
+
+	return r, nil
+}
+
+// globToRegexp *, ?, **を含むglobを正規表現に変換する
+func globToRegexp(pattern string) string {
+	var sb strings.Builder
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				// "**/" は0個以上のディレクトリに一致する
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					sb.WriteString("(.*/)?")
+				} else {
+					sb.WriteString(".*")
+				}
+				continue
+			}
+			sb.WriteString("[^/]*")
+		case '?':
+			sb.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			sb.WriteString("[" + class + "]")
+			i += end
+		default:
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	return sb.String()
+}
+
+// match pathがルールに一致するか判定する
+func (r *ignoreRule) match(path string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+
+	rel, err := filepath.Rel(r.base, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return false
+	}
+	rel = filepath.ToSlash(rel)
+
+	if r.anchored {
+		return r.re.MatchString(rel)
+	}
+
+	return r.re.MatchString(filepath.Base(path))
+}
+
+// ignoreRules 後に追加されたルールほど優先される
+type ignoreRules []*ignoreRule
+
+func (rs ignoreRules) ignored(path string, isDir bool) bool {
+	ignored := false
+	for _, r := range rs {
+		if r.match(path, isDir) {
+			ignored = !r.negate
+		}
+	}
+
+	return ignored
+}
+
+// readGitignore dirに.gitignoreがあればルールを読み込む
+func readGitignore(dir string) (ignoreRules, error) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var rules ignoreRules
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		r, err := newIgnoreRule(dir, scanner.Text())
+		if err != nil {
+			return nil, err
+		}
+		if r != nil {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules, scanner.Err()
+}
+
+// parentGitignores rootの親ディレクトリをリポジトリのルートまで遡って.gitignoreを読み込む
+// サブディレクトリから実行した場合もリポジトリ全体のルールを適用するため
+func parentGitignores(root string) (ignoreRules, error) {
+	dir, err := filepath.Abs(root)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	for {
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			// リポジトリ外で実行された場合は親の.gitignoreは見ない
+			return nil, nil
+		}
+		dir = parent
+		dirs = append(dirs, dir)
+
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+	}
+
+	// 浅い階層のルールから順に適用する
+	var rules ignoreRules
+	for i := len(dirs) - 1; i >= 0; i-- {
+		rs, err := readGitignore(dirs[i])
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rs...)
+	}
+
+	return rules, nil
+}
@@ -7,18 +7,18 @@ import (
 	"go/ast"
 	"go/format"
 	"go/types"
-	"html/template"
 	"io"
-	"os"
+	"path/filepath"
 	"strings"
+	"text/template"
 
-	"golang.org/x/tools/go/ast/inspector"
 	"golang.org/x/tools/go/packages"
 )
 
+// alreadyDecl 対象のレシーバの既存の宣言から引き継ぐ情報
 type alreadyDecl struct {
+	// recvName 既存のメソッドで使われているレシーバ名
 	recvName string
-	methods  map[string]struct{}
 }
 
 // methodSig represents a methodSig signature.
@@ -56,41 +56,155 @@ var tmpl = template.Must(template.New("test").Parse(stub))
 
 const pkgPath = "command-line-arguments"
 
-func Exec(output *string, overwrite, pointerReciever bool) error {
-	srcPath := strings.TrimSuffix(os.Args[len(os.Args)-1], "...")
-	var err error
-	detectedInterface, err = DetectInterface(srcPath)
+// Options Execの動作を指定する
+type Options struct {
+	// SrcPath インターフェースとレシーバーを探すディレクトリ。末尾の...は無視する。空の場合はカレントディレクトリ
+	SrcPath string
+	// Output 出力先のファイルパス。nilの場合は標準出力に書き出す
+	Output *string
+	// Overwrite 選択したレシーバのファイルに追記する
+	Overwrite bool
+	// PointerReciever ポインタレシーバでスタブを作成する
+	PointerReciever bool
+	// Combined ファイルを選ばずにパッケージ内の全ての型を一覧にして選択する
+	Combined bool
+	// IncludeTests _test.goのファイルも選択対象にする
+	IncludeTests bool
+	// Excludes 選択対象から除外するファイルのglob。書式は.gitignoreと同じ
+	Excludes []string
+	// Tags パッケージの読み込みとファイルの選択に使うビルドタグ
+	Tags []string
+	// GOOS, GOARCH 空の場合は実行環境の値を使う
+	GOOS   string
+	GOARCH string
+	// Env go listに追加で渡すKEY=VALUE形式の環境変数
+	Env []string
+	// InterfaceDir, ReceiverDir それぞれの選択対象を探すディレクトリ。空の場合は引数のパスを使う
+	InterfaceDir string
+	ReceiverDir  string
+	// NewType レシーバーを選択せずにこの名前の構造体を新しく作成する
+	NewType string
+	// Constructor 新しく作成する型にNewXxxのコンストラクタを追加する
+	Constructor bool
+	// Mode 生成するコードの種類。空の場合はstub
+	Mode string
+	// Name 新しい型を生成するモードで使う型名。空の場合はモードごとの既定の名前になる
+	// レシーバーを選択するモードでは、Wrapで作成するラッパーの型名として使う
+	Name string
+	// Field delegateモードで呼び出しを委譲するレシーバーのフィールド名。空の場合はnext
+	Field string
+	// Logger log-decoratorモードで使うロガー。slogまたはLog(msg string, keyvals ...interface{})を持つ型の名前。logging.Loggerのようにパッケージ名かインポートパスで修飾できる
+	Logger string
+	// ReadOnly sync-wrapperモードでRLockを使うメソッド名
+	ReadOnly []string
+	// MultiError multiモードでのエラーの扱い。joinは全てのエラーをまとめ、firstは最初のエラーで中断する。空の場合はjoin
+	MultiError string
+	// NoopVar noopモードで型を非公開にし、インターフェース型のNoopXxx変数を追加する
+	NoopVar bool
+	// EmbedUnimplemented gRPCのXxxServerの場合に確認せずUnimplementedXxxServerをレシーバーに埋め込む
+	EmbedUnimplemented bool
+	// SelectField 標準入力が端末でない場合も、インターフェースを実装しているフィールドに委譲するか選択させる
+	SelectField bool
+	// Force 生成したコードがインターフェースを満たせない場合も確認せずに書き出す
+	Force bool
+	// Wrap Outputがレシーバーと別のパッケージの場合に、確認せずレシーバーを埋め込んだラッパー型を出力先に作成する
+	Wrap bool
+	// Dest 書き出し先の決め方。receiverはレシーバーのファイル、type-fileは<型名>.go、それ以外は{{.recv | snake}}_{{.iface | snake}}.goのようなパターン
+	// 生成する型の名前はOptions.Nameで指定した場合のみ使える
+	Dest string
+	// Generated 書き出し先が生成されたファイルの場合の扱い。redirectは同じディレクトリの<型名>_impl.goに書き出し、errorはエラーにする
+	Generated string
+	// Stdout 出力先のファイルを指定しない場合の書き出し先。nilの場合は標準出力
+	Stdout io.Writer
+}
+
+func Exec(opt *Options) error {
+	srcPath := strings.TrimSuffix(opt.SrcPath, "...")
+	if srcPath == "" {
+		srcPath = "."
+	}
+
+	interfaceDir, recvDir := srcPath, srcPath
+	if opt.InterfaceDir != "" {
+		interfaceDir = strings.TrimSuffix(opt.InterfaceDir, "...")
+	}
+	if opt.ReceiverDir != "" {
+		recvDir = strings.TrimSuffix(opt.ReceiverDir, "...")
+	}
+
+	mode, err := opt.modeSpec()
 	if err != nil {
 		return err
 	}
 
-	detectedRecv, err = DetectReciever(srcPath)
+	if opt.Combined {
+		detectedInterface, err = DetectInterfaceFromPackages(interfaceDir, opt)
+	} else {
+		detectedInterface, err = DetectInterface(interfaceDir, opt)
+	}
 	if err != nil {
 		return err
 	}
 
-	config := &packages.Config{
-		Mode: packages.LoadAllSyntax,
+	// 新しい型を生成するモードではレシーバーを選択しない
+	if !mode.recv {
+		return Generate(opt, detectedInterface, nil)
 	}
 
-	interfacePkgs, err := packages.Load(config, detectedInterface.FilePath)
+	switch {
+	case opt.NewType != "":
+		detectedRecv, err = CreateNewType(recvDir, opt.NewType, opt)
+	case opt.Combined:
+		detectedRecv, err = DetectRecieverFromPackages(recvDir, opt)
+	default:
+		detectedRecv, err = DetectReciever(recvDir, opt)
+	}
 	if err != nil {
 		return err
 	}
-	interfacePkg := interfacePkgs[0]
 
-	recvPkgs, err := packages.Load(config, detectedRecv.FilePath)
+	return Generate(opt, detectedInterface, detectedRecv)
+}
+
+// Generate 選択済みのインターフェースとレシーバーからOptions.Modeのコードを生成する
+// レシーバーを使わないモードではrecvにnilを渡す
+func Generate(opt *Options, iface, recv *Result) error {
+	mode, err := opt.modeSpec()
 	if err != nil {
 		return err
 	}
-	recvPkg := recvPkgs[0]
+
+	detectedInterface, detectedRecv = iface, recv
+	if !mode.recv {
+		return generateType(opt, mode)
+	}
+	if recv == nil {
+		return errors.New("receiver is required")
+	}
+
+	// 新しく作成した型はまだ書き出していないため、書き出す前の内容で読み込む
+	edits := recv.edits
+	if edits == nil {
+		edits = newFileEdits()
+	}
+
+	// go.workで別モジュールにある場合も含めて実際のパッケージパスで読み込む
+	pkgs, err := loadPackagesWithOverlay(opt, packages.LoadAllSyntax, edits.contents, detectedInterface.FilePath, detectedRecv.FilePath)
+	if err != nil {
+		return err
+	}
+	interfacePkg, recvPkg := pkgs[0], pkgs[1]
 
 	var (
-		targetInterface *types.Interface
-		targetRecv      *types.TypeName
+		targetRecv *types.TypeName
+		// recvType エイリアスの場合は指している型
+		recvType types.Type
 	)
 
-	for _, syntax := range interfacePkg.Syntax {
+	interfaceObj, targetInterface := findInterface(interfacePkg, detectedInterface.Name)
+
+	var decl *alreadyDecl
+	for _, syntax := range recvPkg.Syntax {
 		ast.Inspect(syntax, func(node ast.Node) bool {
 			nGenDecl, ok := node.(*ast.GenDecl)
 			if !ok {
@@ -103,13 +217,26 @@ func Exec(output *string, overwrite, pointerReciever bool) error {
 					continue
 				}
 
-				defType, ok := interfacePkg.TypesInfo.Defs[t.Name].(*types.TypeName)
+				defType, ok := recvPkg.TypesInfo.Defs[t.Name].(*types.TypeName)
 				if !ok {
 					continue
 				}
 
-				if defT, ok := defType.Type().Underlying().(*types.Interface); ok && defType.Name() == detectedInterface.Name {
-					targetInterface = defT
+				if defType.Name() == detectedRecv.Name {
+					targetRecv = defType
+					recvType = defType.Type()
+					// エイリアスは右辺の型で判定する。ツールチェーンによってはtypes.Aliasとして表されるため右辺の式から求める
+					if t.Assign.IsValid() {
+						if tv, ok := recvPkg.TypesInfo.Types[t.Type]; ok && tv.Type != nil {
+							recvType = tv.Type
+						} else if ident, ok := t.Type.(*ast.Ident); ok {
+							if obj := recvPkg.Types.Scope().Lookup(ident.Name); obj != nil {
+								recvType = obj.Type()
+							}
+						}
+					}
+
+					decl = getAlreadyDecl(targetRecv)
 					return false
 				}
 			}
@@ -118,8 +245,46 @@ func Exec(output *string, overwrite, pointerReciever bool) error {
 		})
 	}
 
-	var decl *alreadyDecl
-	for _, syntax := range recvPkg.Syntax {
+	// ターゲットが見つからないケースはないはずだが一応エラーにしておく
+	if interfaceObj == nil || targetRecv == nil || decl == nil {
+		return errors.New("not found target")
+	}
+
+	// ポインタやインターフェースを元にした型、外部パッケージの型のエイリアスにはメソッドを定義できない
+	switch t := recvType.(type) {
+	case *types.Named:
+		if t.Obj().Pkg() != targetRecv.Pkg() {
+			return fmt.Errorf("%s is an alias of the non-local type %s", targetRecv.Name(), t)
+		}
+		if hasTypeParams(t) {
+			return fmt.Errorf("invalid receiver type %s: generic types are not supported", types.TypeString(t, types.RelativeTo(targetRecv.Pkg())))
+		}
+		switch t.Underlying().(type) {
+		case *types.Pointer, *types.Interface:
+			return fmt.Errorf("invalid receiver type %s: pointer or interface type", targetRecv.Name())
+		}
+	default:
+		return fmt.Errorf("invalid receiver type %s: %s is not a defined type", targetRecv.Name(), t)
+	}
+
+	// ターゲットが見つかったらスタブを書き出す
+	return write(interfaceObj, targetInterface, interfacePkg, targetRecv, decl, recvPkg, edits, opt)
+}
+
+// hasTypeParams 型パラメーターを持つ型かインスタンス化した型か
+// go1.17でもビルドできるようにtypes.Named.TypeParamsを使わず、型名の[T any]のような表記で判定する
+func hasTypeParams(t *types.Named) bool {
+	return strings.Contains(types.TypeString(t, func(*types.Package) string { return "" }), "[")
+}
+
+// findInterface パッケージからnameのインターフェースを探す
+func findInterface(pkg *packages.Package, name string) (*types.TypeName, *types.Interface) {
+	var (
+		targetObj       *types.TypeName
+		targetInterface *types.Interface
+	)
+
+	for _, syntax := range pkg.Syntax {
 		ast.Inspect(syntax, func(node ast.Node) bool {
 			nGenDecl, ok := node.(*ast.GenDecl)
 			if !ok {
@@ -132,15 +297,14 @@ func Exec(output *string, overwrite, pointerReciever bool) error {
 					continue
 				}
 
-				defType, ok := recvPkg.TypesInfo.Defs[t.Name].(*types.TypeName)
+				defType, ok := pkg.TypesInfo.Defs[t.Name].(*types.TypeName)
 				if !ok {
 					continue
 				}
 
-				if _, ok := defType.Type().Underlying().(*types.Struct); ok && defType.Name() == detectedRecv.Name {
-					targetRecv = defType
-
-					decl = getAlreadyDecl(inspector.New(recvPkg.Syntax), targetRecv)
+				if defT, ok := defType.Type().Underlying().(*types.Interface); ok && defType.Name() == name {
+					targetObj = defType
+					targetInterface = defT
 					return false
 				}
 			}
@@ -149,56 +313,139 @@ func Exec(output *string, overwrite, pointerReciever bool) error {
 		})
 	}
 
-	// ターゲットが見つからないケースはないはずだが一応エラーにしておく
-	if targetInterface == nil || targetRecv == nil || decl == nil {
-		return errors.New("not found target")
+	return targetObj, targetInterface
+}
+
+func write(interfaceObj *types.TypeName, targetInterface *types.Interface, interfacePkg *packages.Package, targetRecv *types.TypeName, decl *alreadyDecl, recvPkg *packages.Package, edits *fileEdits, opt *Options) error {
+	mode, err := opt.modeSpec()
+	if err != nil {
+		return err
 	}
 
-	// ターゲットが見つかったらスタブを書き出す
-	return write(targetInterface, targetRecv, decl, output, overwrite, pointerReciever)
-}
+	dst := ""
+	switch {
+	// 新しく作成した型(ラッパーを含む)は同じファイルにスタブを続けて書き出す
+	case detectedRecv.Created:
+		dst = detectedRecv.FilePath
+	case opt.Dest != "":
+		dst, err = resolveDest(opt, detectedRecv.FilePath, filepath.Dir(detectedRecv.FilePath), targetRecv.Name())
+		if err != nil {
+			return err
+		}
+	case opt.Overwrite:
+		dst = detectedRecv.FilePath
+	case opt.Output != nil:
+		dst = *opt.Output
+	}
 
-func write(targetInterface *types.Interface, targetRecv *types.TypeName, decl *alreadyDecl, output *string, overwrite, pointerReciever bool) error {
-	var (
-		f   io.WriteCloser = os.Stdout
-		err error
-	)
-	if overwrite {
-		f, err = os.OpenFile(detectedRecv.FilePath, os.O_WRONLY|os.O_APPEND, 0666)
+	// 別のパッケージのファイルにはレシーバーのメソッドを書けない
+	if dst != "" && dst != detectedRecv.FilePath {
+		reason, err := checkDestination(dst, recvPkg, detectedRecv.FilePath)
 		if err != nil {
 			return err
 		}
-		defer f.Close()
-	} else if output != nil {
-		f, err = os.OpenFile(*output, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0666)
+		if reason != "" {
+			return wrapReceiver(opt, edits, dst, reason, targetRecv)
+		}
+	}
+
+	// 生成されたファイルに書き足すと再生成で失われる
+	if dst != "" {
+		dst, err = checkGenerated(opt, edits, dst, targetRecv.Name())
 		if err != nil {
 			return err
 		}
-		defer f.Close()
 	}
 
-	// スタブメソッドを書き出す
-	for i := 0; i < targetInterface.NumMethods(); i++ {
-		m := targetInterface.Method(i)
+	// 出力先のファイルで既にimportされているパッケージはその名前で参照する
+	renderFile := dst
+	if renderFile == "" {
+		renderFile = detectedRecv.FilePath
+	}
+	r := newTypeRenderer(targetRecv.Pkg(), syntaxOf(recvPkg, renderFile))
+
+	g := &genContext{
+		opt:      opt,
+		r:        r,
+		edits:    edits,
+		ifaceObj: interfaceObj,
+		iface:    targetInterface,
+		ifacePkg: interfacePkg,
+		recv:     targetRecv,
+		recvPkg:  recvPkg,
+		decl:     decl,
+	}
 
-		mSig := m.Type().Underlying().(*types.Signature)
+	// gRPCのXxxServerはUnimplementedXxxServerを埋め込み、RPCのメソッドだけを対象にする
+	if err := g.prepareGRPC(); err != nil {
+		return err
+	}
+	// インターフェースを満たせないコードを黙って書き出さないように、書き出す前に確認する
+	if err := g.confirmAccess(); err != nil {
+		return err
+	}
 
-		funcName := m.Name()
-		funcParams := ArrangePackagePath(detectedRecv.FilePath, detectedInterface.FilePath, mSig.Params().String())
-		funcResults := ArrangePackagePath(detectedRecv.FilePath, detectedInterface.FilePath, mSig.Results().String())
+	src, err := mode.gen(g)
+	if err != nil {
+		return err
+	}
+
+	// 標準出力に書き出す場合もレシーバーのファイルに追記したものとして確かめ、確かめるまでは出力しない
+	verified, verifiedDst := edits, dst
+	if dst == "" {
+		verified, verifiedDst = edits.clone(), detectedRecv.FilePath
+	}
+	if err := output(opt, verified, verifiedDst, targetRecv.Pkg(), src, r); err != nil {
+		return err
+	}
+	if err := g.verifyReceiver(verified, detectedRecv.FilePath); err != nil {
+		return err
+	}
+
+	if err := edits.flush(); err != nil {
+		return err
+	}
+	if dst == "" {
+		return output(opt, edits, dst, targetRecv.Pkg(), src, r)
+	}
+
+	return nil
+}
+
+// genStubMethods 実装済みのもの以外のメソッドをpanicするスタブとして生成する
+func genStubMethods(g *genContext) ([]byte, error) {
+	// インターフェースを実装しているフィールドがあれば、panicするスタブの代わりに委譲できる
+	field, err := g.selectDelegateField()
+	if err != nil {
+		return nil, err
+	}
+	if field != "" {
+		return genDelegateTo(g, field)
+	}
+
+	var buf bytes.Buffer
+
+	// スタブメソッドを書き出す
+	for i := 0; i < g.iface.NumMethods(); i++ {
+		m := g.iface.Method(i)
 
 		// 実装済みのメソッドはスキップ
-		if _, ok := decl.methods[decl.methodKey(funcName, funcParams, funcResults)]; ok {
-			fmt.Println("skip already defined: " + decl.methodKey(funcName, funcParams, funcResults))
+		if g.implemented(m) {
 			continue
 		}
 
+		mSig := m.Type().Underlying().(*types.Signature)
+
+		funcName := m.Name()
+		funcParams := g.r.params(mSig)
+		funcResults := g.r.results(mSig)
+
 		pointer := ""
-		if pointerReciever {
+		if g.opt.PointerReciever {
 			pointer = "*"
 		}
 
-		stub, err := genStubs(fmt.Sprintf("%s %s%s", decl.recvName, pointer, detectedRecv.Name), []funcSig{
+		stub, err := genStubs(fmt.Sprintf("%s %s%s", g.decl.recvName, pointer, detectedRecv.Name), []funcSig{
 			{
 				Name:     funcName,
 				Params:   funcParams,
@@ -207,10 +454,26 @@ func write(targetInterface *types.Interface, targetRecv *types.TypeName, decl *a
 			},
 		})
 		if err != nil {
-			return fmt.Errorf("failed to generate stub, funcName: %s, funcParams: %s, funcResults: %s, err: %w", funcName, funcParams, funcResults, err)
+			return nil, fmt.Errorf("failed to generate stub, funcName: %s, funcParams: %s, funcResults: %s, err: %w", funcName, funcParams, funcResults, err)
 		}
 
-		fmt.Fprintf(f, string(stub))
+		buf.Write(stub)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// syntaxOf パッケージの中からfileNameの構文木を探す
+func syntaxOf(pkg *packages.Package, fileName string) *ast.File {
+	absPath, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil
+	}
+
+	for _, f := range pkg.Syntax {
+		if pkg.Fset.Position(f.Pos()).Filename == absPath {
+			return f
+		}
 	}
 
 	return nil
@@ -233,6 +496,9 @@ func genStubs(recv string, fns []funcSig) ([]byte, error) {
 }
 
 // ArrangePackagePath 配置先のファイルパッケージに合わせてパラメーターのパッケージ指定を調整する
+//
+// Deprecated: ファイルパスからパッケージパスを推測するためgo.workや別モジュールのパッケージを扱えない。
+// スタブの生成ではtypeRendererで実際のパッケージパスから型名を組み立てる
 func ArrangePackagePath(dstFilePath, srcFilePath, srcParams string) string {
 	// ファイル名まで指定されているので取り除く
 	dstFilePath = trimFileName(dstFilePath)
@@ -286,87 +552,24 @@ func trimFileName(str string) string {
 }
 
 // getAlreadyDecl 対象のレシーバに既に実装されている情報を取得する
-func getAlreadyDecl(inspect *inspector.Inspector, targetRecv *types.TypeName) *alreadyDecl {
+// 実装済みのメソッドは埋め込みによる昇格を含めて型情報のメソッドセットから判定する
+func getAlreadyDecl(targetRecv *types.TypeName) *alreadyDecl {
 	result := &alreadyDecl{
 		recvName: strings.ToLower(detectedRecv.Name),
-		methods:  make(map[string]struct{}),
 	}
 
-	inspect.Preorder([]ast.Node{(*ast.FuncDecl)(nil)}, func(n ast.Node) {
-		nType, ok := n.(*ast.FuncDecl)
-		if !ok || nType.Recv == nil {
-			return
-		}
-
-		for _, r := range nType.Recv.List {
-			// 値レシーバーとポインターレシーバーそれぞれチェックする必要がある
-			switch t := r.Type.(type) {
-			case *ast.Ident:
-				if detectedRecv.Name != t.Name {
-					continue
-				}
-			case *ast.StarExpr:
-				if detectedRecv.Name != fmt.Sprint(t.X) {
-					continue
-				}
-			}
-
-			// 対象のオブジェクトに既にレシーバ名が宣言されている場合は合わせる
-			// 違う名前がついていることは考慮しない
-			if len(r.Names) > 0 {
-				result.recvName = r.Names[0].String()
-			}
-
-			// 指定されたレシーバにメソッドが存在する場合はメソッド名・引数・返り値を保存する
-			// 指定されたインターフェースを満たすためのメソッドが既に実装されていれば出力をスキップすることになる
-			var params []string
-			if nType.Type.Params != nil {
-				for _, v := range nType.Type.Params.List {
-					// ここらへん怪しい
-					name := "_"
-					if len(v.Names) != 0 {
-						name = v.Names[0].String()
-					}
-
-					if se, ok := v.Type.(*ast.SelectorExpr); ok {
-						params = append(params, fmt.Sprintf("%s %s.%s", name, se.X.(*ast.Ident).Name, se.Sel.Name))
-					} else {
-						params = append(params, fmt.Sprintf("%s %s", name, v.Type))
-					}
-				}
-			}
-
-			var results []string
-			if nType.Type.Results != nil {
-				for _, v := range nType.Type.Results.List {
-					name := ""
-					if len(v.Names) != 0 {
-						name = v.Names[0].String() + " "
-					}
-
-					if se, ok := v.Type.(*ast.SelectorExpr); ok {
-						results = append(results, fmt.Sprintf("%s%s.%s", name, se.X.(*ast.Ident).Name, se.Sel.Name))
-					} else {
-						results = append(results, fmt.Sprintf("%s%s", name, v.Type))
-					}
-				}
-			}
+	named, ok := targetRecv.Type().(*types.Named)
+	if !ok {
+		return result
+	}
 
-			result.appendMethod(nType.Name.String(), fmt.Sprintf("(%s)", strings.Join(params, ", ")), fmt.Sprintf("(%s)", strings.Join(results, ", ")))
+	// 対象のオブジェクトに既にレシーバ名が宣言されている場合は合わせる
+	// 違う名前がついていることは考慮しない
+	for i := 0; i < named.NumMethods(); i++ {
+		if name := named.Method(i).Type().(*types.Signature).Recv().Name(); name != "" && name != "_" {
+			result.recvName = name
 		}
-	})
-
-	return result
-}
-
-func (a *alreadyDecl) appendMethod(name, params, results string) {
-	if a == nil {
-		return
 	}
 
-	a.methods[a.methodKey(name, params, results)] = struct{}{}
-}
-
-func (a *alreadyDecl) methodKey(name, params, results string) string {
-	return fmt.Sprintf("%s(%s) (%s)", name, params, results)
+	return result
 }
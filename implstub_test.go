@@ -1,9 +1,18 @@
 package implstub_test
 
 import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 
 	"github.com/YuuSatoh/implstub"
+	"golang.org/x/tools/go/packages"
 )
 
 // TestAnalyzer is a test for Analyzer.
@@ -13,30 +22,595 @@ func TestAnalyzer(t *testing.T) {
 }
 
 func TestExec(t *testing.T) {
-	type args struct {
-		output          *string
-		overwrite       bool
-		pointerReciever bool
+	tests := []struct {
+		name    string
+		files   map[string]string
+		opt     implstub.Options
+		wantErr string
+	}{
+		{
+			name:    "Goファイルがないディレクトリを指定した場合はエラーになる",
+			files:   map[string]string{"README.md": "# m\n"},
+			opt:     implstub.Options{SrcPath: "..."},
+			wantErr: "no go files found",
+		},
+		{
+			name:    "不明なモードを指定した場合はエラーになる",
+			files:   map[string]string{"store.go": "package store\n"},
+			opt:     implstub.Options{Mode: "unknown"},
+			wantErr: "unknown",
+		},
 	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeModule(t, tt.files)
+			tt.opt.SrcPath = filepath.Join(dir, tt.opt.SrcPath)
+
+			err := implstub.Exec(&tt.opt)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Exec() error = %v, wantErr %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	hoge := &implstub.Result{Name: "Hoge", FilePath: "testdata/src/b/b.go"}
+	foo := &implstub.Result{Name: "Foo", FilePath: "testdata/src/b/b.go"}
+	bar := &implstub.Result{Name: "Bar", FilePath: "testdata/src/b/b.go"}
+	baz := &implstub.Result{Name: "Baz", FilePath: "testdata/src/b/b.go"}
+	cache := &implstub.Result{Name: "Cache", FilePath: "testdata/src/b/b.go"}
+	bdb := &implstub.Result{Name: "BDB", FilePath: "testdata/src/b/b.go"}
+	adb := &implstub.Result{Name: "ADB", FilePath: "testdata/src/a/a.go"}
+	bfoo := &implstub.Result{Name: "BFoo", FilePath: "testdata/src/b/b.go"}
+	bnext := &implstub.Result{Name: "BNext", FilePath: "testdata/src/b/b.go"}
+	bambiguous := &implstub.Result{Name: "BAmbiguous", FilePath: "testdata/src/b/b.go"}
+	bbase := &implstub.Result{Name: "BBase", FilePath: "testdata/src/b/b.go"}
+	bids := &implstub.Result{Name: "BIDs", FilePath: "testdata/src/b/b.go"}
+	balias := &implstub.Result{Name: "BAlias", FilePath: "testdata/src/b/b.go"}
+	bptr := &implstub.Result{Name: "BPtr", FilePath: "testdata/src/b/b.go"}
+	lener := &implstub.Result{Name: "Lener", FilePath: "testdata/src/generic/generic.go"}
+	set := &implstub.Result{Name: "Set", FilePath: "testdata/src/generic/generic.go"}
+	intSet := &implstub.Result{Name: "IntSet", FilePath: "testdata/src/generic/generic.go"}
+
 	tests := []struct {
 		name    string
-		args    args
+		opt     implstub.Options
+		iface   *implstub.Result
+		recv    *implstub.Result
+		want    string
 		wantErr bool
 	}{
 		{
-			name: "",
-			args: args{
-				output:          nil,
-				overwrite:       true,
-				pointerReciever: false,
-			},
-			wantErr: false,
+			name:  "実装済みのメソッドはスキップされる",
+			iface: hoge,
+			recv:  bdb,
+			want: `// piyo comments...
+func (bdb BDB) piyo(adb a.ADB, db BDB) error {
+	panic("not implemented") // TODO: Implement
+}
+
+`,
+		},
+		{
+			name:  "別パッケージのレシーバーではインターフェース側の型がパッケージ名で修飾される",
+			opt:   implstub.Options{PointerReciever: true},
+			iface: bar,
+			recv:  adb,
+			want: `// Bow comments...
+func (adb *ADB) Bow(db c.CDB) (err error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`,
+		},
+		{
+			name:    "別パッケージのインターフェースの非公開メソッドは実装できないためエラーになる",
+			iface:   foo,
+			recv:    adb,
+			wantErr: true,
+		},
+		{
+			name:  "forceを指定した場合は実装できない非公開メソッドをスキップして続ける",
+			opt:   implstub.Options{Force: true},
+			iface: foo,
+			recv:  adb,
+			want:  "",
+		},
+		{
+			name:    "別パッケージの非公開の型を参照するシグネチャは書けないためエラーになる",
+			iface:   baz,
+			recv:    adb,
+			wantErr: true,
+		},
+		{
+			name:  "mockモードでは関数フィールドを呼び出すモックが生成される",
+			opt:   implstub.Options{Mode: "mock"},
+			iface: foo,
+			want: `// FooMock is a mock implementation of Foo.
+type FooMock struct {
+	// BowFunc mocks the bow method.
+	BowFunc func(db c.CDB) error
+
+	calls struct {
+		bow []FooMockBowCall
+	}
+	lock sync.Mutex
+}
+
+var _ Foo = &FooMock{}
+
+// FooMockBowCall holds the arguments of a call to bow.
+type FooMockBowCall struct {
+	Db c.CDB
+}
+
+// bow calls BowFunc.
+func (mock *FooMock) bow(db c.CDB) error {
+	if mock.BowFunc == nil {
+		panic("FooMock.BowFunc: method is nil but Foo.bow was just called")
+	}
+	callInfo := FooMockBowCall{
+		Db: db,
+	}
+	mock.lock.Lock()
+	mock.calls.bow = append(mock.calls.bow, callInfo)
+	mock.lock.Unlock()
+	return mock.BowFunc(db)
+}
+
+// BowCalls returns the calls made to bow.
+func (mock *FooMock) BowCalls() []FooMockBowCall {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return append([]FooMockBowCall(nil), mock.calls.bow...)
+}
+`,
+		},
+		{
+			name:  "gomockモードではgomockのコントローラーで使うモックが生成される",
+			opt:   implstub.Options{Mode: "gomock"},
+			iface: foo,
+			want: `// MockFoo is a mock of Foo interface.
+type MockFoo struct {
+	ctrl     *gomock.Controller
+	recorder *MockFooMockRecorder
+}
+
+// MockFooMockRecorder is the mock recorder for MockFoo.
+type MockFooMockRecorder struct {
+	mock *MockFoo
+}
+
+// NewMockFoo creates a new mock instance.
+func NewMockFoo(ctrl *gomock.Controller) *MockFoo {
+	mock := &MockFoo{ctrl: ctrl}
+	mock.recorder = &MockFooMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockFoo) EXPECT() *MockFooMockRecorder {
+	return m.recorder
+}
+
+// bow mocks base method.
+func (m *MockFoo) bow(db c.CDB) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "bow", db)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// bow indicates an expected call of bow.
+func (mr *MockFooMockRecorder) bow(db interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "bow", reflect.TypeOf((*MockFoo)(nil).bow), db)
+}
+`,
+		},
+		{
+			name:  "log-decoratorモードでは呼び出しをログに出力するラッパーが生成される",
+			opt:   implstub.Options{Mode: "log-decorator"},
+			iface: foo,
+			want: `// LoggingFoo wraps Foo and logs every method call.
+type LoggingFoo struct {
+	next   Foo
+	logger *slog.Logger
+}
+
+var _ Foo = &LoggingFoo{}
+
+// NewLoggingFoo returns a Foo that logs the calls to next through logger.
+func NewLoggingFoo(next Foo, logger *slog.Logger) *LoggingFoo {
+	return &LoggingFoo{next: next, logger: logger}
+}
+
+// bow logs the call and forwards it to the wrapped Foo.
+func (l *LoggingFoo) bow(db c.CDB) error {
+	start := time.Now()
+	r0 := l.next.bow(db)
+	l.logger.Info("Foo.bow", "db", db, "err", r0, "duration", time.Since(start))
+	return r0
+}
+`,
+		},
+		{
+			name:  "log-decoratorモードでは指定した型のLogで出力する",
+			opt:   implstub.Options{Mode: "log-decorator", Logger: "Logger", Name: "FooLogger"},
+			iface: foo,
+			want: `// FooLogger wraps Foo and logs every method call.
+type FooLogger struct {
+	next   Foo
+	logger Logger
+}
+
+var _ Foo = &FooLogger{}
+
+// NewFooLogger returns a Foo that logs the calls to next through logger.
+func NewFooLogger(next Foo, logger Logger) *FooLogger {
+	return &FooLogger{next: next, logger: logger}
+}
+
+// bow logs the call and forwards it to the wrapped Foo.
+func (l *FooLogger) bow(db c.CDB) error {
+	start := time.Now()
+	r0 := l.next.bow(db)
+	l.logger.Log("Foo.bow", "db", db, "err", r0, "duration", time.Since(start))
+	return r0
+}
+`,
+		},
+		{
+			name:  "sync-wrapperモードではmutexで保護するラッパーが生成される",
+			opt:   implstub.Options{Mode: "sync-wrapper"},
+			iface: foo,
+			want: `// SyncFoo wraps Foo and guards every method call with a mutex.
+type SyncFoo struct {
+	mu   sync.Mutex
+	next Foo
+}
+
+var _ Foo = &SyncFoo{}
+
+// NewSyncFoo returns a Foo that is safe for concurrent use.
+func NewSyncFoo(next Foo) *SyncFoo {
+	return &SyncFoo{next: next}
+}
+
+// bow forwards the call to the wrapped Foo while holding the lock.
+func (s *SyncFoo) bow(db c.CDB) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.next.bow(db)
+}
+`,
+		},
+		{
+			name:  "sync-wrapperモードではコメントで指定したメソッドがRLockを使う",
+			opt:   implstub.Options{Mode: "sync-wrapper"},
+			iface: cache,
+			want: `// SyncCache wraps Cache and guards every method call with a mutex.
+type SyncCache struct {
+	mu   sync.RWMutex
+	next Cache
+}
+
+var _ Cache = &SyncCache{}
+
+// NewSyncCache returns a Cache that is safe for concurrent use.
+func NewSyncCache(next Cache) *SyncCache {
+	return &SyncCache{next: next}
+}
+
+// get forwards the call to the wrapped Cache while holding the read lock.
+func (s *SyncCache) get(key string) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.next.get(key)
+}
+
+// set forwards the call to the wrapped Cache while holding the lock.
+func (s *SyncCache) set(key string, value string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.next.set(key, value)
+}
+`,
+		},
+		{
+			name:    "sync-wrapperモードで存在しないメソッドを指定した場合はエラーになる",
+			opt:     implstub.Options{Mode: "sync-wrapper", ReadOnly: []string{"get"}},
+			iface:   foo,
+			wantErr: true,
+		},
+		{
+			name:  "multiモードでは全ての実装を呼び出し、エラーをまとめる型が生成される",
+			opt:   implstub.Options{Mode: "multi"},
+			iface: foo,
+			want: `// multiFoo calls every Foo in order.
+type multiFoo []Foo
+
+var _ Foo = multiFoo(nil)
+
+// bow calls bow of every Foo in order.
+func (m multiFoo) bow(db c.CDB) error {
+	var errs []error
+	for _, impl := range m {
+		err := impl.bow(db)
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+`,
+		},
+		{
+			name:  "multiモードでfirstを指定した場合は最初のエラーを返す",
+			opt:   implstub.Options{Mode: "multi", MultiError: "first"},
+			iface: foo,
+			want: `// multiFoo calls every Foo in order.
+type multiFoo []Foo
+
+var _ Foo = multiFoo(nil)
+
+// bow calls bow of every Foo in order.
+func (m multiFoo) bow(db c.CDB) error {
+	for _, impl := range m {
+		err := impl.bow(db)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+`,
+		},
+		{
+			name:  "noopモードではゼロ値を返す型が生成される",
+			opt:   implstub.Options{Mode: "noop"},
+			iface: hoge,
+			want: `// NoopHoge is a Hoge that does nothing.
+type NoopHoge struct{}
+
+var _ Hoge = NoopHoge{}
+
+// piyo does nothing and returns zero values.
+func (NoopHoge) piyo(adb a.ADB, db BDB) error {
+	return nil
+}
+
+// yey does nothing and returns zero values.
+func (NoopHoge) yey(msg string, id int64) (string, error) {
+	return "", nil
+}
+`,
+		},
+		{
+			name:  "noopモードでnoop-varを指定した場合は非公開の型と公開の変数が生成される",
+			opt:   implstub.Options{Mode: "noop", NoopVar: true},
+			iface: cache,
+			want: `// noopCache is a Cache that does nothing.
+type noopCache struct{}
+
+// NoopCache is a Cache that does nothing.
+var NoopCache Cache = noopCache{}
+
+// get does nothing and returns zero values.
+func (noopCache) get(key string) string {
+	return ""
+}
+
+// set does nothing.
+func (noopCache) set(key string, value string) {}
+`,
+		},
+		{
+			name:  "func-adapterモードではメソッドが1つの場合に関数型が生成される",
+			opt:   implstub.Options{Mode: "func-adapter"},
+			iface: foo,
+			want: `// FooFunc is an adapter to allow the use of an ordinary function as a Foo.
+type FooFunc func(db c.CDB) error
+
+var _ Foo = FooFunc(nil)
+
+// bow calls f(db).
+func (f FooFunc) bow(db c.CDB) error {
+	return f(db)
+}
+`,
+		},
+		{
+			name:  "func-adapterモードではメソッドが複数の場合に関数フィールドの構造体が生成される",
+			opt:   implstub.Options{Mode: "func-adapter"},
+			iface: cache,
+			want: `// CacheFuncs is an adapter to implement Cache with a function for each method.
+type CacheFuncs struct {
+	GetFunc func(key string) string
+	SetFunc func(key string, value string)
+}
+
+var _ Cache = CacheFuncs{}
+
+// get calls GetFunc.
+func (f CacheFuncs) get(key string) string {
+	return f.GetFunc(key)
+}
+
+// set calls SetFunc.
+func (f CacheFuncs) set(key string, value string) {
+	f.SetFunc(key, value)
+}
+`,
+		},
+		{
+			name:  "埋め込んだ型から昇格するメソッドは実装済みとしてスキップされる",
+			iface: foo,
+			recv:  bfoo,
+			want:  "",
+		},
+		{
+			name:  "埋め込んだインターフェースから昇格するメソッドは実装済みとしてスキップされる",
+			iface: foo,
+			recv:  bnext,
+			want:  "",
+		},
+		{
+			name:  "別パッケージから埋め込んだ型から昇格するメソッドは実装済みとしてスキップされる",
+			iface: bar,
+			recv:  bbase,
+			want:  "",
+		},
+		{
+			name:  "同じ深さの埋め込みから昇格してセレクタが曖昧なメソッドはスタブが生成される",
+			iface: hoge,
+			recv:  bambiguous,
+			want: `// piyo comments...
+func (bambiguous BAmbiguous) piyo(adb a.ADB, db BDB) error {
+	panic("not implemented") // TODO: Implement
+}
+
+// yey comments...
+func (bambiguous BAmbiguous) yey(msg string, id int64) (string, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`,
+		},
+		{
+			name:  "unimplementedモードではerrorを返すメソッドがエラーを、それ以外はpanicする型が生成される",
+			opt:   implstub.Options{Mode: "unimplemented"},
+			iface: cache,
+			want: `// UnimplementedCache can be embedded to have forward compatible implementations of Cache.
+type UnimplementedCache struct{}
+
+var _ Cache = UnimplementedCache{}
+
+// get is not implemented.
+func (UnimplementedCache) get(key string) string {
+	panic("Cache.get is not implemented")
+}
+
+// set is not implemented.
+func (UnimplementedCache) set(key string, value string) {
+	panic("Cache.set is not implemented")
+}
+`,
+		},
+		{
+			name:  "unimplementedモードではerrorの前の返り値はゼロ値になる",
+			opt:   implstub.Options{Mode: "unimplemented"},
+			iface: hoge,
+			want: `// UnimplementedHoge can be embedded to have forward compatible implementations of Hoge.
+type UnimplementedHoge struct{}
+
+var _ Hoge = UnimplementedHoge{}
+
+// piyo is not implemented.
+func (UnimplementedHoge) piyo(adb a.ADB, db BDB) error {
+	return errors.New("Hoge.piyo is not implemented")
+}
+
+// yey is not implemented.
+func (UnimplementedHoge) yey(msg string, id int64) (string, error) {
+	return "", errors.New("Hoge.yey is not implemented")
+}
+`,
+		},
+		{
+			name:  "構造体以外の型もレシーバーにできる",
+			iface: bar,
+			recv:  bids,
+			want: `// Bow comments...
+func (bids BIDs) Bow(db c.CDB) (err error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`,
+		},
+		{
+			name:    "別パッケージの型のエイリアスにはメソッドを定義できないためエラーになる",
+			iface:   bar,
+			recv:    balias,
+			wantErr: true,
+		},
+		{
+			name:    "ポインタ型にはメソッドを定義できないためエラーになる",
+			iface:   bar,
+			recv:    bptr,
+			wantErr: true,
+		},
+		{
+			name:    "型パラメーターを持つ型はエラーになる",
+			iface:   lener,
+			recv:    set,
+			wantErr: true,
+		},
+		{
+			name:    "インスタンス化した型のエイリアスはエラーになる",
+			iface:   lener,
+			recv:    intSet,
+			wantErr: true,
+		},
+		{
+			name:    "存在しないモードはエラーになる",
+			opt:     implstub.Options{Mode: "unknown"},
+			iface:   foo,
+			recv:    bdb,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.opt.Stdout = &buf
+
+			err := implstub.Generate(&tt.opt, tt.iface, tt.recv)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got := buf.String(); got != tt.want {
+				t.Errorf("Generate() output = \n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReceiverPreviews(t *testing.T) {
+	got, err := implstub.ReceiverPreviews("testdata/src/b/b.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		recv string
+		want string
+	}{
+		{
+			name: "構造体はフィールドを表示する",
+			recv: "BDB",
+			want: "type BDB struct {\n\tname string\n\tAdb a.ADB\n}",
+		},
+		{
+			name: "構造体以外は元になる型を表示する",
+			recv: "BIDs",
+			want: "type BIDs []int",
+		},
+		{
+			name: "別パッケージの型のエイリアスは一覧に含まれない",
+			recv: "BAlias",
+		},
+		{
+			name: "ポインタ型は一覧に含まれない",
+			recv: "BPtr",
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := implstub.Exec(tt.args.output, tt.args.overwrite, tt.args.pointerReciever); (err != nil) != tt.wantErr {
-				t.Errorf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			if got[tt.recv] != tt.want {
+				t.Errorf("preview of %s = %q, want %q", tt.recv, got[tt.recv], tt.want)
 			}
 		})
 	}
@@ -116,3 +690,1356 @@ func TestArrangePackagePath(t *testing.T) {
 		})
 	}
 }
+
+func TestFindGoFiles(t *testing.T) {
+	files := map[string]string{
+		"a.go":                 "package a",
+		"a_test.go":            "package a",
+		"README.md":            "",
+		"go.sum":               "",
+		".gitignore":           "gen/\n*_mock.go\n!keep_mock.go\n",
+		"b/b.go":               "package b",
+		"b/b_mock.go":          "package b",
+		"b/keep_mock.go":       "package b",
+		"b/.gitignore":         "/local.go\n",
+		"b/local.go":           "package b",
+		"b/b_windows.go":       "package b",
+		"b/tagged.go":          "//go:build custom\n\npackage b",
+		"gen/gen.go":           "package gen",
+		"vendor/v/v.go":        "package v",
+		"testdata/src/t.go":    "package t",
+		".hidden/h.go":         "package h",
+		"node_modules/x/x.go":  "package x",
+		"internal/skip/s.go":   "package skip",
+		"internal/keep/k.go":   "package keep",
+		"internal/keep/.x.go":  "package keep",
+		"internal/keep/_x.go":  "package keep",
+		"internal/keep/k.json": "",
+	}
+
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		opt  *implstub.Options
+		want []string
+	}{
+		{
+			name: "Goファイル以外と除外対象のディレクトリ、.gitignoreに一致するファイルは含まれない",
+			opt:  &implstub.Options{},
+			want: []string{"a.go", "b/b.go", "b/keep_mock.go", "internal/keep/k.go", "internal/skip/s.go"},
+		},
+		{
+			name: "include-testsを指定した場合はテストファイルが含まれる",
+			opt:  &implstub.Options{IncludeTests: true},
+			want: []string{"a.go", "a_test.go", "b/b.go", "b/keep_mock.go", "internal/keep/k.go", "internal/skip/s.go"},
+		},
+		{
+			name: "excludeに一致するファイルとディレクトリは含まれない",
+			opt:  &implstub.Options{Excludes: []string{"internal/skip", "keep_*.go"}},
+			want: []string{"a.go", "b/b.go", "internal/keep/k.go"},
+		},
+		{
+			name: "ビルドタグとGOOSを指定した場合は制約に一致するファイルが含まれる",
+			opt:  &implstub.Options{Tags: []string{"custom"}, GOOS: "windows"},
+			want: []string{"a.go", "b/b.go", "b/b_windows.go", "b/keep_mock.go", "b/tagged.go", "internal/keep/k.go", "internal/skip/s.go"},
+		},
+		{
+			name: "GOFLAGSで指定したビルドタグも考慮される",
+			opt:  &implstub.Options{Env: []string{"GOFLAGS=-tags=custom"}},
+			want: []string{"a.go", "b/b.go", "b/keep_mock.go", "b/tagged.go", "internal/keep/k.go", "internal/skip/s.go"},
+		},
+		{
+			name: "excludeには**を指定できる",
+			opt:  &implstub.Options{Excludes: []string{"**/k*.go"}},
+			want: []string{"a.go", "b/b.go", "internal/skip/s.go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := implstub.FindGoFiles(root, tt.opt)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := range got {
+				rel, err := filepath.Rel(root, got[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[i] = filepath.ToSlash(rel)
+			}
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindGoFiles() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTypeDeclLabels(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"store/store.go":    "package store\n\ntype Store interface {\n\tGet() string\n}\n\ntype Cache struct{}\n\ntype ID = Cache\n\ntype Name = string\n",
+		"repo/repo.go":      "package repo\n\ntype Repo struct{}\n",
+		"repo/repo_test.go": "package repo\n\ntype fakeRepo struct{}\n",
+	})
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		opt        implstub.Options
+		interfaces bool
+		want       []string
+	}{
+		{
+			name:       "インターフェースはパッケージ名と位置つきで一覧になる",
+			interfaces: true,
+			want:       []string{"store.Store — " + filepath.Join(rel, "store", "store.go") + ":3"},
+		},
+		{
+			name: "レシーバーには同じパッケージの型のエイリアスも含まれる",
+			want: []string{
+				"repo.Repo — " + filepath.Join(rel, "repo", "repo.go") + ":3",
+				"store.Cache — " + filepath.Join(rel, "store", "store.go") + ":7",
+				"store.ID — " + filepath.Join(rel, "store", "store.go") + ":9",
+			},
+		},
+		{
+			name: "include-testsを指定した場合はテストファイルの型も含まれる",
+			opt:  implstub.Options{IncludeTests: true},
+			want: []string{
+				"repo.Repo — " + filepath.Join(rel, "repo", "repo.go") + ":3",
+				"repo.fakeRepo — " + filepath.Join(rel, "repo", "repo_test.go") + ":3",
+				"store.Cache — " + filepath.Join(rel, "store", "store.go") + ":7",
+				"store.ID — " + filepath.Join(rel, "store", "store.go") + ":9",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := implstub.TypeDeclLabels(dir, &tt.opt, tt.interfaces)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sort.Strings(got)
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("TypeDeclLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateNewType(t *testing.T) {
+	const store = "package store\n\ntype Any interface{}\n\ntype Private interface {\n\tget() string\n}\n"
+
+	tests := []struct {
+		name     string
+		files    map[string]string
+		typeName string
+		iface    string
+		opt      implstub.Options
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "ファイルが存在しない場合はディレクトリ名のパッケージで作成される",
+			typeName: "HogeRepository",
+			iface:    "Any",
+			want:     "package repo\n\n// HogeRepository comments...\ntype HogeRepository struct{}\n",
+		},
+		{
+			name:     "同じディレクトリのファイルのパッケージ名が使われ、コンストラクタが追加される",
+			files:    map[string]string{"repo/other.go": "package infra\n"},
+			typeName: "HogeRepository",
+			iface:    "Any",
+			opt:      implstub.Options{Constructor: true},
+			want:     "package infra\n\n// HogeRepository comments...\ntype HogeRepository struct{}\n\n// NewHogeRepository comments...\nfunc NewHogeRepository() *HogeRepository {\n\treturn &HogeRepository{}\n}\n",
+		},
+		{
+			name:     "生成を中止した場合は型も作成されない",
+			typeName: "HogeRepository",
+			iface:    "Private",
+			wantErr:  true,
+		},
+		{
+			name:     "既に宣言されている名前の場合はエラーになる",
+			files:    map[string]string{"repo/other.go": "package infra\n\ntype HogeRepository struct{}\n"},
+			typeName: "HogeRepository",
+			wantErr:  true,
+		},
+		{
+			name:     "識別子として使えない名前の場合はエラーになる",
+			typeName: "hoge-repository",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files := map[string]string{"store/store.go": store}
+			for name, content := range tt.files {
+				files[name] = content
+			}
+			dir := writeModule(t, files)
+			repo := filepath.Join(dir, "repo")
+
+			output := filepath.Join(repo, "hoge_repository.go")
+			tt.opt.Output = &output
+
+			err := func() error {
+				got, err := implstub.CreateNewType(repo, tt.typeName, &tt.opt)
+				if err != nil {
+					return err
+				}
+				if got.Name != tt.typeName || got.FilePath != output || !got.Created {
+					t.Errorf("CreateNewType() = %+v", got)
+				}
+				// 型の宣言は生成したコードと一緒に書き出す
+				if _, err := os.Stat(output); !os.IsNotExist(err) {
+					t.Errorf("CreateNewType() wrote %s before Generate", output)
+				}
+
+				return implstub.Generate(&tt.opt, &implstub.Result{Name: tt.iface, FilePath: filepath.Join(dir, "store", "store.go")}, got)
+			}()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, err := os.Stat(output); !os.IsNotExist(err) {
+					t.Errorf("%s was created", output)
+				}
+				return
+			}
+
+			content, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("created file = %q, want %q", content, tt.want)
+			}
+		})
+	}
+}
+
+// writeModule 一時ディレクトリにfilesを書き出し、そのディレクトリを返す
+// filesにgo.modがない場合はexample.com/mのモジュールにする
+func writeModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, ok := files["go.mod"]; !ok {
+		write("go.mod", "module example.com/m\n\ngo 1.17\n")
+	}
+	for name, content := range files {
+		write(name, content)
+	}
+
+	return dir
+}
+
+func TestPromptLine(t *testing.T) {
+	// パイプで渡した回答は1行ずつ、続けて呼び出したプロンプトに渡る
+	defer implstub.SetStdin(strings.NewReader("y\n  Hoge \n"))()
+
+	for _, want := range []string{"y", "Hoge"} {
+		got, err := implstub.PromptLine("> ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("PromptLine() = %q, want %q", got, want)
+		}
+	}
+
+	if _, err := implstub.PromptLine("> "); err != io.EOF {
+		t.Errorf("PromptLine() error = %v, want %v", err, io.EOF)
+	}
+}
+
+func TestGenerateWorkspace(t *testing.T) {
+	// ワークスペースモードでは-mod=modを指定できないため、実行環境のGOFLAGSを使わない
+	t.Setenv("GOFLAGS", "")
+
+	files := map[string]string{
+		"go.work":          "go 1.18\n\nuse (\n\t./a\n\t./b\n)\n",
+		"a/go.mod":         "module example.com/a\n\ngo 1.18\n",
+		"a/store/store.go": "package store\n\ntype Item struct{}\n\ntype Store interface {\n\tGet(id string) *Item\n}\n",
+		"b/go.mod":         "module example.com/b\n\ngo 1.18\n",
+		"b/store/store.go": "package store\n\ntype Local struct{}\n",
+		"b/impl/helper.go": "package impl\n",
+		"b/impl/impl.go":   "package impl\n\ntype Impl struct{}\n",
+	}
+	const stub = `// Get comments...
+func (impl *Impl) Get(id string) *%s.Item {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+	tests := []struct {
+		name string
+		opt  implstub.Options
+		file string
+		src  string
+		recv string
+		want string
+	}{
+		{
+			name: "別モジュールのインターフェースの型はimportを追加して修飾される",
+			file: "b/impl/impl.go",
+			src:  "package impl\n\ntype Impl struct{}\n",
+			recv: "Impl",
+			want: "package impl\n\nimport \"example.com/a/store\"\n\ntype Impl struct{}\n\n" + fmt.Sprintf(stub, "store"),
+		},
+		{
+			name: "別名でimport済みのパッケージはその名前で修飾される",
+			file: "b/impl/impl.go",
+			src:  "package impl\n\nimport as \"example.com/a/store\"\n\nvar _ as.Item\n\ntype Impl struct{}\n",
+			recv: "Impl",
+			want: "package impl\n\nimport as \"example.com/a/store\"\n\nvar _ as.Item\n\ntype Impl struct{}\n\n" + fmt.Sprintf(stub, "as"),
+		},
+		{
+			name: "同じ名前のパッケージがimport済みの場合は別名をつけてimportする",
+			file: "b/impl/impl.go",
+			src:  "package impl\n\nimport \"example.com/b/store\"\n\nvar _ store.Local\n\ntype Impl struct{}\n",
+			recv: "Impl",
+			want: "package impl\n\nimport (\n\tstore2 \"example.com/a/store\"\n\t\"example.com/b/store\"\n)\n\nvar _ store.Local\n\ntype Impl struct{}\n\n" + fmt.Sprintf(stub, "store2"),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			all := map[string]string{tt.file: tt.src}
+			for name, content := range files {
+				if _, ok := all[name]; !ok {
+					all[name] = content
+				}
+			}
+			dir := writeModule(t, all)
+
+			fileName := filepath.Join(dir, tt.file)
+			opt := &implstub.Options{Overwrite: true, PointerReciever: true}
+			err := implstub.Generate(opt,
+				&implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "a", "store", "store.go")},
+				&implstub.Result{Name: tt.recv, FilePath: fileName},
+			)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			content, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("generated file = \n%s\nwant\n%s", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateReplace(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"a/go.mod":         "module example.com/a\n\ngo 1.17\n",
+		"a/model/model.go": "package model\n\ntype ID string\n",
+		"a/store/store.go": "package store\n\nimport \"example.com/a/model\"\n\ntype Store interface {\n\tGet(id model.ID) error\n}\n",
+		"b/go.mod":         "module example.com/b\n\ngo 1.17\n\nrequire example.com/a v0.0.0\n\nreplace example.com/a => ../a\n",
+		"b/repo/repo.go":   "package repo\n\ntype Repo struct{}\n",
+	})
+	fileName := filepath.Join(dir, "b", "repo", "repo.go")
+
+	// replaceで参照する別モジュールのインターフェースも、レシーバーのモジュールで読み込んだ型と比べて確かめる
+	opt := &implstub.Options{Overwrite: true, PointerReciever: true}
+	err := implstub.Generate(opt,
+		&implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "a", "store", "store.go")},
+		&implstub.Result{Name: "Repo", FilePath: fileName},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `package repo
+
+import "example.com/a/model"
+
+type Repo struct{}
+
+// Get comments...
+func (repo *Repo) Get(id model.ID) error {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+	if string(content) != want {
+		t.Errorf("generated file = \n%s\nwant\n%s", content, want)
+	}
+}
+
+func TestPackageOf(t *testing.T) {
+	pkgs := []*packages.Package{
+		{ID: "example.com/m/impl [example.com/m/impl.test]", GoFiles: []string{"/m/impl/impl.go", "/m/impl/impl_test.go"}},
+		{ID: "example.com/m/impl", GoFiles: []string{"/m/impl/impl.go"}},
+		{ID: "example.com/m/other", GoFiles: []string{"/m/other/other.go"}},
+	}
+
+	tests := []struct {
+		name     string
+		fileName string
+		want     string
+	}{
+		{
+			name:     "テスト用のパッケージにも含まれるファイルは通常のパッケージを優先する",
+			fileName: "/m/impl/impl.go",
+			want:     "example.com/m/impl",
+		},
+		{
+			name:     "テストファイルはテスト用のパッケージから見つかる",
+			fileName: "/m/impl/impl_test.go",
+			want:     "example.com/m/impl [example.com/m/impl.test]",
+		},
+		{
+			name:     "どのパッケージにも含まれないファイルは見つからない",
+			fileName: "/m/none/none.go",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if pkg := implstub.PackageOf(pkgs, tt.fileName); pkg != nil {
+				got = pkg.ID
+			}
+			if got != tt.want {
+				t.Errorf("PackageOf() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateLogger(t *testing.T) {
+	const logging = `package logging
+
+type Logger struct{}
+
+func (l *Logger) Log(msg string, keyvals ...interface{}) {}
+
+type Plain struct{}
+`
+	const store = `package store
+
+type Store interface {
+	Get(key string) string
+}
+`
+	const importing = `package store
+
+import "example.com/m/logging"
+
+var _ = logging.Logger{}
+
+type Store interface {
+	Get(key string) string
+}
+`
+
+	tests := []struct {
+		name    string
+		store   string
+		logger  string
+		want    []string
+		wantErr string
+	}{
+		{
+			name:   "インターフェースのパッケージが依存しているパッケージの型はパッケージ名で指定でき、ポインタ型になる",
+			store:  importing,
+			logger: "logging.Logger",
+			want:   []string{"logger *logging.Logger", `l.logger.Log("Store.Get", "key", key, "r0", r0, "duration", time.Since(start))`},
+		},
+		{
+			name:   "依存していないパッケージの型はインポートパスで指定できる",
+			store:  store,
+			logger: "example.com/m/logging.Logger",
+			want:   []string{"logger *logging.Logger", "func NewLoggingStore(next Store, logger *logging.Logger) *LoggingStore {"},
+		},
+		{
+			name:    "Logを持たない型はエラーになる",
+			store:   importing,
+			logger:  "logging.Plain",
+			wantErr: "has no method Log",
+		},
+		{
+			name:    "見つからないパッケージの型はエラーになる",
+			store:   store,
+			logger:  "zap.Logger",
+			wantErr: "is not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeModule(t, map[string]string{
+				"logging/logging.go": logging,
+				"store/store.go":     tt.store,
+			})
+			fileName := filepath.Join(dir, "store", "store.go")
+
+			var buf bytes.Buffer
+			opt := &implstub.Options{Mode: "log-decorator", Logger: tt.logger, Stdout: &buf}
+			err := implstub.Generate(opt, &implstub.Result{Name: "Store", FilePath: fileName}, nil)
+			if (err != nil) != (tt.wantErr != "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Generate() error = %v, wantErr %q", err, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				return
+			}
+
+			for _, want := range tt.want {
+				if !strings.Contains(buf.String(), want) {
+					t.Errorf("generated code = \n%s\nwant to contain %s", buf.String(), want)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateDelegate(t *testing.T) {
+	const src = `package store
+
+type Store interface {
+	Get(key string, opts ...int) (value string, err error)
+	Put(key, value string)
+}
+
+type Cache struct {
+	size int
+}
+
+func (c *Cache) Put(key string, value string) {}
+`
+
+	const put = "func (c *Cache) Put(key string, value string) {}"
+
+	tests := []struct {
+		name string
+		opt  implstub.Options
+		// put srcのPutの宣言を置き換える
+		put     string
+		want    string
+		wantErr string
+	}{
+		{
+			name: "フィールドがない場合は追加され、未実装のメソッドだけが委譲される",
+			opt:  implstub.Options{PointerReciever: true},
+			want: `package store
+
+type Store interface {
+	Get(key string, opts ...int) (value string, err error)
+	Put(key, value string)
+}
+
+type Cache struct {
+	size int
+	next Store
+}
+
+func (c *Cache) Put(key string, value string) {}
+
+// Get delegates to next.Get.
+func (c *Cache) Get(key string, opts ...int) (value string, err error) {
+	return c.next.Get(key, opts...)
+}
+`,
+		},
+		{
+			name: "同じ型の引数をまとめて宣言したメソッドも実装済みとしてスキップされる",
+			opt:  implstub.Options{PointerReciever: true},
+			put:  "func (c *Cache) Put(key, value string) {}",
+			want: `package store
+
+type Store interface {
+	Get(key string, opts ...int) (value string, err error)
+	Put(key, value string)
+}
+
+type Cache struct {
+	size int
+	next Store
+}
+
+func (c *Cache) Put(key, value string) {}
+
+// Get delegates to next.Get.
+func (c *Cache) Get(key string, opts ...int) (value string, err error) {
+	return c.next.Get(key, opts...)
+}
+`,
+		},
+		{
+			name:    "インターフェースを実装していないフィールドを指定した場合は足りないメソッドを示して何も書き出さない",
+			opt:     implstub.Options{PointerReciever: true, Field: "size"},
+			wantErr: "missing method Get",
+		},
+		{
+			name:    "メソッドを指定した場合はエラーになる",
+			opt:     implstub.Options{Field: "Put"},
+			wantErr: "is not a field",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := src
+			if tt.put != "" {
+				src = strings.Replace(src, put, tt.put, 1)
+			}
+			dir := writeModule(t, map[string]string{"store.go": src})
+			fileName := filepath.Join(dir, "store.go")
+
+			tt.opt.Mode = "delegate"
+			tt.opt.Overwrite = true
+			err := implstub.Generate(&tt.opt,
+				&implstub.Result{Name: "Store", FilePath: fileName},
+				&implstub.Result{Name: "Cache", FilePath: fileName},
+			)
+			if (err != nil) != (tt.wantErr != "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Generate() error = %v, wantErr %q", err, tt.wantErr)
+			}
+			if tt.wantErr != "" {
+				tt.want = src
+			}
+
+			content, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("generated file = \n%s\nwant\n%s", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateDelegateField(t *testing.T) {
+	const src = `package store
+
+type Store interface {
+	Get(key string) string
+}
+
+type Cache struct {
+	backend Store
+}
+`
+	dir := writeModule(t, map[string]string{"store.go": src})
+	fileName := filepath.Join(dir, "store.go")
+
+	// 標準入力が端末でない場合は委譲するフィールドを選択させずにスタブを生成する
+	err := implstub.Generate(&implstub.Options{Overwrite: true},
+		&implstub.Result{Name: "Store", FilePath: fileName},
+		&implstub.Result{Name: "Cache", FilePath: fileName},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := src + `
+// Get comments...
+func (cache Cache) Get(key string) string {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+	if string(content) != want {
+		t.Errorf("generated file = \n%s\nwant\n%s", content, want)
+	}
+}
+
+func TestGenerateGRPC(t *testing.T) {
+	const pb = `package pb
+
+type HelloRequest struct{}
+
+type HelloReply struct{}
+
+type GreeterServer interface {
+	SayHello(req *HelloRequest) (*HelloReply, error)
+	SayBye(req *HelloRequest) (*HelloReply, error)
+	mustEmbedUnimplementedGreeterServer()
+}
+
+type UnimplementedGreeterServer struct{}
+
+func (UnimplementedGreeterServer) SayHello(req *HelloRequest) (*HelloReply, error) {
+	return nil, nil
+}
+
+func (UnimplementedGreeterServer) SayBye(req *HelloRequest) (*HelloReply, error) {
+	return nil, nil
+}
+
+func (UnimplementedGreeterServer) mustEmbedUnimplementedGreeterServer() {}
+`
+
+	tests := []struct {
+		name   string
+		server string
+		opt    implstub.Options
+		want   string
+	}{
+		{
+			name: "UnimplementedXxxServerを埋め込み、RPCのメソッドだけスタブが生成される",
+			server: `package server
+
+import "example.com/m/pb"
+
+type Server struct {
+	name string
+}
+
+func (s *Server) SayBye(req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return nil, nil
+}
+`,
+			opt: implstub.Options{PointerReciever: true, EmbedUnimplemented: true},
+			want: `package server
+
+import "example.com/m/pb"
+
+type Server struct {
+	pb.UnimplementedGreeterServer
+
+	name string
+}
+
+func (s *Server) SayBye(req *pb.HelloRequest) (*pb.HelloReply, error) {
+	return nil, nil
+}
+
+// SayHello comments...
+func (s *Server) SayHello(req *pb.HelloRequest) (*pb.HelloReply, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`,
+		},
+		{
+			name: "既に埋め込まれている場合も昇格したRPCのメソッドのスタブが生成される",
+			server: `package server
+
+import "example.com/m/pb"
+
+type Server struct {
+	pb.UnimplementedGreeterServer
+}
+`,
+			opt: implstub.Options{PointerReciever: true},
+			want: `package server
+
+import "example.com/m/pb"
+
+type Server struct {
+	pb.UnimplementedGreeterServer
+}
+
+// SayBye comments...
+func (server *Server) SayBye(req *pb.HelloRequest) (*pb.HelloReply, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// SayHello comments...
+func (server *Server) SayHello(req *pb.HelloRequest) (*pb.HelloReply, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeModule(t, map[string]string{
+				"pb/pb.go":         pb,
+				"server/server.go": tt.server,
+			})
+
+			serverFile := filepath.Join(dir, "server", "server.go")
+			tt.opt.Overwrite = true
+			err := implstub.Generate(&tt.opt,
+				&implstub.Result{Name: "GreeterServer", FilePath: filepath.Join(dir, "pb", "pb.go")},
+				&implstub.Result{Name: "Server", FilePath: serverFile},
+			)
+			if err != nil {
+				t.Fatalf("Generate() error = %v", err)
+			}
+
+			content, err := os.ReadFile(serverFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("generated file = \n%s\nwant\n%s", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateDestination(t *testing.T) {
+	files := map[string]string{
+		"store/store.go": "package store\n\ntype Store interface {\n\tGet(key string) string\n\tPut(key string, value string)\n}\n",
+		"impl/impl.go":   "package impl\n\ntype Impl struct{}\n\nfunc (i *Impl) Get(key string) string {\n\treturn \"\"\n}\n",
+	}
+
+	tests := []struct {
+		name    string
+		output  string
+		files   map[string]string
+		opt     implstub.Options
+		want    string
+		wantErr bool
+	}{
+		{
+			name:   "別パッケージのファイルを指定してwrapを指定した場合はレシーバーを埋め込んだラッパーが作成される",
+			output: "wrap/impl.go",
+			opt:    implstub.Options{Wrap: true},
+			want: `package wrap
+
+import "example.com/m/impl"
+
+// ImplWrapper comments...
+type ImplWrapper struct {
+	impl.Impl
+}
+
+// Put comments...
+func (implwrapper ImplWrapper) Put(key string, value string) {
+	panic("not implemented") // TODO: Implement
+}
+
+`,
+		},
+		{
+			name:    "ラッパーのコードを確かめられない場合はラッパーもディレクトリも作成されない",
+			output:  "wrap/impl.go",
+			files:   map[string]string{"impl/impl.go": "package impl\n\ntype Impl struct{}\n\nfunc (i *Impl) Put(key int) {}\n"},
+			opt:     implstub.Options{Wrap: true},
+			wantErr: true,
+		},
+		{
+			name:    "別のディレクトリのファイルを指定した場合はエラーになる",
+			output:  "wrap/impl.go",
+			wantErr: true,
+		},
+		{
+			name:    "同じディレクトリでもパッケージ名が違うファイルを指定した場合はエラーになる",
+			output:  "impl/impl_test.go",
+			files:   map[string]string{"impl/impl_test.go": "package impl_test\n"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			all := make(map[string]string)
+			for _, fs := range []map[string]string{files, tt.files} {
+				for name, content := range fs {
+					all[name] = content
+				}
+			}
+			dir := writeModule(t, all)
+
+			output := filepath.Join(dir, tt.output)
+			tt.opt.Output = &output
+			err := implstub.Generate(&tt.opt,
+				&implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "store", "store.go")},
+				&implstub.Result{Name: "Impl", FilePath: filepath.Join(dir, "impl", "impl.go")},
+			)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, ok := all[tt.output]; !ok {
+					if _, err := os.Stat(filepath.Dir(output)); !os.IsNotExist(err) {
+						t.Errorf("%s was created", filepath.Dir(output))
+					}
+				}
+				return
+			}
+
+			content, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("generated file = \n%s\nwant\n%s", content, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerateVerify(t *testing.T) {
+	const iface = "package store\n\ntype Store interface {\n\tGet(key string) string\n\tPut(key string, value string)\n}\n"
+
+	tests := []struct {
+		name    string
+		src     string
+		opt     implstub.Options
+		wantErr bool
+	}{
+		{
+			name: "インターフェースを実装できる場合は書き出される",
+			src:  "package store\n\ntype Cache struct{}\n\nfunc (c *Cache) Get(key string) string {\n\treturn \"\"\n}\n",
+			opt:  implstub.Options{PointerReciever: true},
+		},
+		{
+			name:    "シグネチャの違うメソッドがある場合は実装できないため何も書き出さない",
+			src:     "package store\n\ntype Cache struct{}\n\nfunc (c *Cache) Get(key int) string {\n\treturn \"\"\n}\n",
+			opt:     implstub.Options{PointerReciever: true},
+			wantErr: true,
+		},
+		{
+			name:    "標準出力に書き出す場合もレシーバーのファイルに追記したものとして確かめる",
+			src:     "package store\n\ntype Cache struct{}\n\nfunc (c *Cache) Get(key int) string {\n\treturn \"\"\n}\n",
+			opt:     implstub.Options{PointerReciever: true, Stdout: &bytes.Buffer{}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeModule(t, map[string]string{
+				"store.go": iface,
+				"cache.go": tt.src,
+			})
+
+			fileName := filepath.Join(dir, "cache.go")
+			tt.opt.Overwrite = tt.opt.Stdout == nil
+			err := implstub.Generate(&tt.opt,
+				&implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "store.go")},
+				&implstub.Result{Name: "Cache", FilePath: fileName},
+			)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			content, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if changed := string(content) != tt.src; changed == tt.wantErr {
+				t.Errorf("file changed = %v, want %v", changed, !tt.wantErr)
+			}
+			// 確かめる前に標準出力へ書き出さない
+			if buf, ok := tt.opt.Stdout.(*bytes.Buffer); ok && tt.wantErr && buf.Len() > 0 {
+				t.Errorf("stdout = %q, want empty", buf.String())
+			}
+		})
+	}
+}
+
+func TestGenerateTypeVerify(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"store/store.go": "package store\n\ntype Store interface {\n\tGet(key string) string\n}\n",
+	})
+	output := filepath.Join(dir, "dom", "noop.go")
+
+	generate := func() error {
+		return implstub.Generate(&implstub.Options{Mode: "noop", Output: &output},
+			&implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "store", "store.go")}, nil)
+	}
+	if err := generate(); err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 同じ型を再び生成すると再宣言の型エラーになるため何も書き出さない
+	if err := generate(); err == nil {
+		t.Fatal("Generate() error = nil, want redeclared error")
+	}
+	content, err := os.ReadFile(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != string(want) {
+		t.Errorf("generated file = \n%s\nwant\n%s", content, want)
+	}
+}
+
+func TestUndo(t *testing.T) {
+	const src = "package store\n\ntype Store interface {\n\tGet(key string) string\n}\n\ntype Cache struct{}\n"
+
+	tests := []struct {
+		name     string
+		modify   bool
+		wantErr  bool
+		wantFile string
+	}{
+		{
+			name:     "変更したファイルが元に戻る",
+			wantFile: src,
+		},
+		{
+			name:    "実行後に変更されたファイルがある場合は何も戻さない",
+			modify:  true,
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeModule(t, map[string]string{"store.go": src})
+			fileName := filepath.Join(dir, "store.go")
+			if err := os.Chmod(fileName, 0600); err != nil {
+				t.Fatal(err)
+			}
+
+			opt := &implstub.Options{Overwrite: true}
+			err := implstub.Generate(opt,
+				&implstub.Result{Name: "Store", FilePath: fileName},
+				&implstub.Result{Name: "Cache", FilePath: fileName},
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			info, err := os.Stat(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != 0600 {
+				t.Errorf("permission = %v, want %v", info.Mode().Perm(), os.FileMode(0600))
+			}
+
+			ignore, err := os.ReadFile(filepath.Join(dir, ".implstub", ".gitignore"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(ignore) != "*\n" {
+				t.Errorf(".implstub/.gitignore = %q, want %q", ignore, "*\n")
+			}
+
+			generated, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify {
+				generated = append(generated, "\n// edited\n"...)
+				if err := os.WriteFile(fileName, generated, 0600); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.wantFile == "" {
+				tt.wantFile = string(generated)
+			}
+
+			if err := implstub.Undo(dir); (err != nil) != tt.wantErr {
+				t.Fatalf("Undo() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			content, err := os.ReadFile(fileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.wantFile {
+				t.Errorf("file = \n%s\nwant\n%s", content, tt.wantFile)
+			}
+		})
+	}
+}
+
+func TestUndoCreated(t *testing.T) {
+	dir := writeModule(t, map[string]string{
+		"store/store.go": "package store\n\ntype Store interface {\n\tGet(key string) string\n}\n",
+	})
+	repo := filepath.Join(dir, "infra", "repo")
+	output := filepath.Join(repo, "cache.go")
+
+	opt := &implstub.Options{Output: &output}
+	recv, err := implstub.CreateNewType(repo, "Cache", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := implstub.Generate(opt, &implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "store", "store.go")}, recv); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(output); err != nil {
+		t.Fatal(err)
+	}
+
+	// 型の作成と生成したコードは1つの実行として記録され、作成したディレクトリごと戻る
+	if err := implstub.Undo(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "infra")); !os.IsNotExist(err) {
+		t.Errorf("%s was not removed", filepath.Join(dir, "infra"))
+	}
+}
+
+func TestUndoWorkspace(t *testing.T) {
+	// ワークスペースモードでは-mod=modを指定できないため、実行環境のGOFLAGSを使わない
+	t.Setenv("GOFLAGS", "")
+
+	const impl = "package impl\n\ntype Impl struct{}\n"
+	dir := writeModule(t, map[string]string{
+		"go.work":          "go 1.18\n\nuse (\n\t./a // interfaces\n\t./b\n)\n",
+		"a/go.mod":         "module example.com/a\n\ngo 1.18\n",
+		"a/store/store.go": "package store\n\ntype Store interface {\n\tGet(id string) string\n}\n",
+		"b/go.mod":         "module example.com/b\n\ngo 1.18\n",
+		"b/impl/impl.go":   impl,
+	})
+	fileName := filepath.Join(dir, "b", "impl", "impl.go")
+
+	err := implstub.Generate(&implstub.Options{Overwrite: true},
+		&implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "a", "store", "store.go")},
+		&implstub.Result{Name: "Impl", FilePath: fileName},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 記録はモジュールのルートに置かれ、go.workのディレクトリからも戻せる
+	if _, err := os.Stat(filepath.Join(dir, "b", ".implstub", "journal.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := implstub.Undo(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := os.ReadFile(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(content) != impl {
+		t.Errorf("file = \n%s\nwant\n%s", content, impl)
+	}
+}
+
+func TestGenerateGenerated(t *testing.T) {
+	const iface = "package store\n\ntype Store interface {\n\tGet(key string) string\n}\n"
+	const stub = `
+// Get comments...
+func (cacheitem *CacheItem) Get(key string) string {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+	tests := []struct {
+		name     string
+		src      string
+		opt      implstub.Options
+		wantFile string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "生成されたファイルの場合は同じディレクトリの<型名>_impl.goに書き出す",
+			src:      "// Code generated by sqlc. DO NOT EDIT.\n\npackage store\n\ntype CacheItem struct{}\n",
+			wantFile: "cache_item_impl.go",
+			want:     "package store\n" + stub,
+		},
+		{
+			name:    "errorを指定した場合は生成されたファイルに書き出さずエラーになる",
+			src:     "// Code generated by sqlc. DO NOT EDIT.\n\npackage store\n\ntype CacheItem struct{}\n",
+			opt:     implstub.Options{Generated: "error"},
+			wantErr: true,
+		},
+		{
+			name:     "パッケージ宣言より後のコメントは生成されたファイルの印として扱わない",
+			src:      "package store\n\n// Code generated by sqlc. DO NOT EDIT.\n\ntype CacheItem struct{}\n",
+			wantFile: "cache.go",
+			want:     "package store\n\n// Code generated by sqlc. DO NOT EDIT.\n\ntype CacheItem struct{}\n" + stub,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeModule(t, map[string]string{
+				"store.go": iface,
+				"cache.go": tt.src,
+			})
+
+			tt.opt.Overwrite = true
+			tt.opt.PointerReciever = true
+			err := implstub.Generate(&tt.opt,
+				&implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "store.go")},
+				&implstub.Result{Name: "CacheItem", FilePath: filepath.Join(dir, "cache.go")},
+			)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				tt.wantFile, tt.want = "cache.go", tt.src
+			}
+
+			content, err := os.ReadFile(filepath.Join(dir, tt.wantFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("%s = \n%s\nwant\n%s", tt.wantFile, content, tt.want)
+			}
+		})
+	}
+}
+
+func TestCreateNewTypeGenerated(t *testing.T) {
+	const gen = "// Code generated by protoc-gen-go. DO NOT EDIT.\n\npackage infra\n"
+	dir := writeModule(t, map[string]string{
+		"store/store.go":  "package store\n\ntype Store interface{}\n",
+		"infra/gen.pb.go": gen,
+	})
+	infra := filepath.Join(dir, "infra")
+	output := filepath.Join(infra, "gen.pb.go")
+
+	// 生成されたファイルを指定した場合は、型もスタブと同じ<型名>_impl.goに作成する
+	opt := &implstub.Options{Output: &output}
+	recv, err := implstub.CreateNewType(infra, "Svc", opt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := implstub.Generate(opt, &implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "store", "store.go")}, recv); err != nil {
+		t.Fatal(err)
+	}
+
+	for fileName, want := range map[string]string{
+		"gen.pb.go":   gen,
+		"svc_impl.go": "package infra\n\n// Svc comments...\ntype Svc struct{}\n",
+	} {
+		content, err := os.ReadFile(filepath.Join(infra, fileName))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(content) != want {
+			t.Errorf("%s = %q, want %q", fileName, content, want)
+		}
+	}
+}
+
+func TestGenerateDest(t *testing.T) {
+	const iface = "package store\n\ntype Store interface {\n\tGet(key string) string\n}\n"
+	const src = "package store\n\ntype CacheItem struct{}\n"
+	const stub = `// Get comments...
+func (cacheitem *CacheItem) Get(key string) string {
+	panic("not implemented") // TODO: Implement
+}
+
+`
+
+	tests := []struct {
+		name     string
+		opt      implstub.Options
+		wantFile string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "receiverの場合はレシーバーのファイルに追記する",
+			opt:      implstub.Options{Dest: "receiver"},
+			wantFile: "cache.go",
+			want:     src + "\n" + stub,
+		},
+		{
+			name:     "type-fileの場合は型名のファイルを作成する",
+			opt:      implstub.Options{Dest: "type-file"},
+			wantFile: "cache_item.go",
+			want:     "package store\n\n" + stub,
+		},
+		{
+			name:     "パターンの場合はレシーバーとインターフェースの名前からファイル名を決める",
+			opt:      implstub.Options{Dest: "{{.recv | snake}}_{{.iface | snake}}.go"},
+			wantFile: "cache_item_store.go",
+			want:     "package store\n\n" + stub,
+		},
+		{
+			name:     "型を生成するモードでは型の名前を指定した場合にパターンで使える",
+			opt:      implstub.Options{Dest: "{{.recv | snake}}.go", Mode: "noop", Name: "NoopStore"},
+			wantFile: "noop_store.go",
+			want: `package store
+
+// NoopStore is a Store that does nothing.
+type NoopStore struct{}
+
+var _ Store = NoopStore{}
+
+// Get does nothing and returns zero values.
+func (NoopStore) Get(key string) string {
+	return ""
+}
+`,
+		},
+		{
+			name:    "生成する型の名前がわからない場合に{{.recv}}を使うとエラーになる",
+			opt:     implstub.Options{Dest: "{{.recv}}.go", Mode: "noop"},
+			wantErr: true,
+		},
+		{
+			name:    "Goのファイルにならないパターンはエラーになる",
+			opt:     implstub.Options{Dest: "{{.recv}}.txt"},
+			wantErr: true,
+		},
+		{
+			name:    "fileと同時に指定した場合はエラーになる",
+			opt:     implstub.Options{Dest: "receiver", Overwrite: true},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeModule(t, map[string]string{
+				"store.go": iface,
+				"cache.go": src,
+			})
+
+			tt.opt.PointerReciever = true
+			var recv *implstub.Result
+			if tt.opt.Mode == "" {
+				recv = &implstub.Result{Name: "CacheItem", FilePath: filepath.Join(dir, "cache.go")}
+			}
+			err := implstub.Generate(&tt.opt, &implstub.Result{Name: "Store", FilePath: filepath.Join(dir, "store.go")}, recv)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Generate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			content, err := os.ReadFile(filepath.Join(dir, tt.wantFile))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != tt.want {
+				t.Errorf("%s = \n%s\nwant\n%s", tt.wantFile, content, tt.want)
+			}
+		})
+	}
+}
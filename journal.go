@@ -0,0 +1,299 @@
+package implstub
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// journalDir 変更したファイルの記録とバックアップを置くディレクトリ
+const journalDir = ".implstub"
+
+// journalFile journalDirに置く変更の記録
+const journalFile = "journal.json"
+
+// journalIgnore journalDirをgitの管理から外すためにjournalDirに置く.gitignore
+const journalIgnore = ".gitignore"
+
+// runID 1回の実行を表すID。同じ実行での書き出しは同じ記録にまとめる
+var runID = fmt.Sprintf("%d-%d", os.Getpid(), time.Now().UnixNano())
+
+// journal 最後の実行で変更したファイルの記録
+type journal struct {
+	Run   string         `json:"run"`
+	Files []journalEntry `json:"files"`
+	// Dirs 新しいファイルのために作成したディレクトリ
+	Dirs []string `json:"dirs,omitempty"`
+}
+
+// journalEntry 変更したファイル1つの記録
+type journalEntry struct {
+	// Path 変更したファイルの絶対パス
+	Path string `json:"path"`
+	// Backup 変更前の内容を保存したファイル名。Createdの場合は空
+	Backup string `json:"backup,omitempty"`
+	// Created 実行前には存在しなかった
+	Created bool `json:"created,omitempty"`
+	// Perm 変更前のパーミッション
+	Perm os.FileMode `json:"perm"`
+	// Sum 書き出した内容のsha256。undoの前に変更されていないか確かめる
+	Sum string `json:"sum"`
+}
+
+// journalRoot fileNameの変更を記録するディレクトリ。モジュールのルートに置き、モジュール外の場合はファイルのディレクトリに置く
+func journalRoot(fileName string) string {
+	dir := filepath.Dir(fileName)
+	if mod := findUp(dir, "go.mod"); mod != "" {
+		dir = filepath.Dir(mod)
+	}
+
+	return filepath.Join(dir, journalDir)
+}
+
+// readJournal rootの記録を読み込む。記録がなければnilを返す
+func readJournal(root string) (*journal, error) {
+	content, err := os.ReadFile(filepath.Join(root, journalFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var j journal
+	if err := json.Unmarshal(content, &j); err != nil {
+		return nil, fmt.Errorf("broken journal %s: %w", filepath.Join(root, journalFile), err)
+	}
+
+	return &j, nil
+}
+
+// record 書き出す前のファイルをバックアップして記録に加える
+// 別の実行の記録が残っていれば、その記録とバックアップを捨てて新しく始める
+func (e *fileEdits) record() error {
+	if len(e.order) == 0 {
+		return nil
+	}
+
+	root := journalRoot(e.order[0])
+	j, err := readJournal(root)
+	if err != nil {
+		return err
+	}
+	if j == nil || j.Run != runID {
+		if err := os.RemoveAll(root); err != nil {
+			return err
+		}
+		j = &journal{Run: runID}
+
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return err
+		}
+		// 記録とバックアップをコミットしないように、ディレクトリごと無視させる
+		if err := writeFileAtomic(filepath.Join(root, journalIgnore), []byte("*\n"), 0644); err != nil {
+			return err
+		}
+	}
+
+	recorded := make(map[string]int)
+	for i, entry := range j.Files {
+		recorded[entry.Path] = i
+	}
+
+	for _, fileName := range e.order {
+		sum := checksum(e.contents[fileName])
+
+		// 同じ実行で既に記録したファイルは最初の状態のバックアップを残す
+		if i, ok := recorded[fileName]; ok {
+			j.Files[i].Sum = sum
+			continue
+		}
+
+		entry := journalEntry{Path: fileName, Perm: 0666, Sum: sum}
+		original, err := os.ReadFile(fileName)
+		switch {
+		case os.IsNotExist(err):
+			entry.Created = true
+			j.Dirs = append(j.Dirs, missingDirs(filepath.Dir(fileName), j.Dirs)...)
+		case err != nil:
+			return err
+		default:
+			info, err := os.Stat(fileName)
+			if err != nil {
+				return err
+			}
+			entry.Perm = info.Mode().Perm()
+			entry.Backup = strconv.Itoa(len(j.Files)) + ".orig"
+			if err := writeFileAtomic(filepath.Join(root, entry.Backup), original, 0644); err != nil {
+				return err
+			}
+		}
+
+		recorded[fileName] = len(j.Files)
+		j.Files = append(j.Files, entry)
+	}
+
+	content, err := json.MarshalIndent(j, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(filepath.Join(root, journalFile), content, 0644)
+}
+
+// Undo dirから親ディレクトリへ遡って見つけた記録を元に、最後の実行で変更したファイルを元に戻す
+// 実行後に変更されたファイルがあれば何も戻さずにエラーを返す
+func Undo(dir string) error {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+
+	path := findUp(absDir, filepath.Join(journalDir, journalFile))
+	if path == "" {
+		// 記録はモジュールのルートに置くため、go.workのディレクトリなどからはuseのモジュールの記録を探す
+		path, err = workspaceJournal(absDir)
+		if err != nil {
+			return err
+		}
+	}
+	if path == "" {
+		return fmt.Errorf("no journal found in %s, its parents or the modules of its go.work", absDir)
+	}
+	root := filepath.Dir(path)
+
+	j, err := readJournal(root)
+	if err != nil {
+		return err
+	}
+
+	var modified []string
+	for _, entry := range j.Files {
+		content, err := os.ReadFile(entry.Path)
+		if err != nil || checksum(content) != entry.Sum {
+			modified = append(modified, entry.Path)
+		}
+	}
+	if len(modified) > 0 {
+		return fmt.Errorf("modified since the last run, nothing was restored: %s", strings.Join(modified, ", "))
+	}
+
+	for _, entry := range j.Files {
+		if entry.Created {
+			if err := os.Remove(entry.Path); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "removed %s\n", entry.Path)
+			continue
+		}
+
+		original, err := os.ReadFile(filepath.Join(root, entry.Backup))
+		if err != nil {
+			return err
+		}
+		if err := writeFileAtomic(entry.Path, original, entry.Perm); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "restored %s\n", entry.Path)
+	}
+
+	// 作成したディレクトリは空になった場合のみ、深いものから削除する
+	sort.Slice(j.Dirs, func(a, b int) bool { return len(j.Dirs[a]) > len(j.Dirs[b]) })
+	for _, dir := range j.Dirs {
+		if err := os.Remove(dir); err == nil {
+			fmt.Fprintf(os.Stderr, "removed %s\n", dir)
+		}
+	}
+
+	return os.RemoveAll(root)
+}
+
+// workspaceJournal dirで有効なgo.workのuseのモジュールに置いた記録のうち最も新しいもののパス。なければ空文字を返す
+func workspaceJournal(dir string) (string, error) {
+	work := workspaceFile(&Options{}, dir)
+	if work == "" {
+		return "", nil
+	}
+
+	uses, err := workspaceUses(work)
+	if err != nil {
+		return "", err
+	}
+
+	var (
+		path    string
+		modTime time.Time
+	)
+	for _, use := range uses {
+		candidate := filepath.Join(use, journalDir, journalFile)
+		info, err := os.Stat(candidate)
+		if err != nil {
+			continue
+		}
+		if path == "" || info.ModTime().After(modTime) {
+			path, modTime = candidate, info.ModTime()
+		}
+	}
+
+	return path, nil
+}
+
+// missingDirs dirとその親のうちまだ存在しないディレクトリを返す。recordedに含まれるものは除く
+func missingDirs(dir string, recorded []string) []string {
+	var dirs []string
+	for {
+		if _, err := os.Stat(dir); err == nil {
+			return dirs
+		}
+		for _, r := range recorded {
+			if r == dir {
+				return dirs
+			}
+		}
+
+		dirs = append(dirs, dir)
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dirs
+		}
+		dir = parent
+	}
+}
+
+// writeFileAtomic 同じディレクトリの一時ファイルに書き込んでから置き換える
+// 途中で失敗しても元のファイルは壊れない
+func writeFileAtomic(fileName string, content []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(fileName), "."+filepath.Base(fileName)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	// Renameに成功した後は一時ファイルが存在しないので失敗を無視する
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), fileName)
+}
+
+// checksum 変更されていないか確かめるための内容のsha256
+func checksum(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
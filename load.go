@@ -0,0 +1,217 @@
+package implstub
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/tools/go/packages"
+)
+
+// loadPackages 指定したファイルを含むパッケージをそれぞれ読み込む
+// 同じモジュールもしくは同じgo.workに含まれる場合はまとめて読み込み、型を共有させる
+func loadPackages(opt *Options, mode packages.LoadMode, fileNames ...string) ([]*packages.Package, error) {
+	return loadPackagesWithOverlay(opt, mode, nil, fileNames...)
+}
+
+// loadPackagesWithOverlay ファイルの内容をoverlayで置き換えてloadPackagesと同様に読み込む
+// overlayのキーは絶対パスで、存在しないファイルを追加することもできる
+func loadPackagesWithOverlay(opt *Options, mode packages.LoadMode, overlay map[string][]byte, fileNames ...string) ([]*packages.Package, error) {
+	files := make([]string, len(fileNames))
+	dirs := make([]string, len(fileNames))
+	for i, fileName := range fileNames {
+		absPath, err := filepath.Abs(fileName)
+		if err != nil {
+			return nil, err
+		}
+		files[i] = absPath
+		dirs[i] = filepath.Dir(absPath)
+	}
+
+	var groups [][]int
+	for i := range dirs {
+		joined := false
+		for g, group := range groups {
+			if loadableTogether(opt, dirs[group[0]], dirs[i]) {
+				groups[g] = append(group, i)
+				joined = true
+				break
+			}
+		}
+		if !joined {
+			groups = append(groups, []int{i})
+		}
+	}
+
+	result := make([]*packages.Package, len(files))
+	for _, group := range groups {
+		config := opt.packagesConfig(mode)
+		// overlayで追加するファイルのディレクトリはまだ存在しない場合がある
+		config.Dir = existingDir(dirs[group[0]])
+		config.Tests = opt.IncludeTests
+		config.Overlay = overlay
+
+		var patterns []string
+		for _, i := range group {
+			patterns = append(patterns, dirs[i])
+		}
+
+		pkgs, err := packages.Load(config, patterns...)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed packages.Load")
+		}
+
+		for _, i := range group {
+			pkg := packageOf(pkgs, files[i])
+			if pkg == nil {
+				return nil, fmt.Errorf("package not found: %s", fileNames[i])
+			}
+			result[i] = pkg
+		}
+	}
+
+	return result, nil
+}
+
+// loadPackageWithImport fileNameのパッケージとpkgPathのパッケージを1度のpackages.Loadで読み込む
+// 別々に読み込んだパッケージの型は比較できないため、fileNameのモジュールからpkgPathを解決する
+// pkgPathを解決できない場合はimportedにnilを返す
+func loadPackageWithImport(opt *Options, mode packages.LoadMode, overlay map[string][]byte, fileName, pkgPath string) (pkg, imported *packages.Package, err error) {
+	absPath, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := opt.packagesConfig(mode)
+	config.Dir = existingDir(filepath.Dir(absPath))
+	config.Tests = opt.IncludeTests
+	config.Overlay = overlay
+
+	pkgs, err := packages.Load(config, filepath.Dir(absPath), pkgPath)
+	if err != nil {
+		return nil, nil, errors.Wrap(err, "failed packages.Load")
+	}
+
+	pkg = packageOf(pkgs, absPath)
+	if pkg == nil {
+		return nil, nil, fmt.Errorf("package not found: %s", fileName)
+	}
+	for _, p := range pkgs {
+		if p.PkgPath == pkgPath && p.Types != nil && len(p.Errors) == 0 && !strings.Contains(p.ID, " [") {
+			imported = p
+		}
+	}
+
+	return pkg, imported, nil
+}
+
+// packageOf fileNameを含むパッケージを返す。テスト用のパッケージよりも通常のパッケージを優先する
+func packageOf(pkgs []*packages.Package, fileName string) *packages.Package {
+	var found *packages.Package
+	for _, pkg := range pkgs {
+		for _, f := range pkg.GoFiles {
+			if f != fileName {
+				continue
+			}
+
+			if found == nil || !strings.Contains(pkg.ID, " [") {
+				found = pkg
+			}
+		}
+	}
+
+	return found
+}
+
+// loadableTogether 2つのディレクトリを1度のpackages.Loadで読み込めるか
+func loadableTogether(opt *Options, dir1, dir2 string) bool {
+	if work := workspaceFile(opt, dir1); work != "" {
+		return work == workspaceFile(opt, dir2)
+	}
+
+	mod := findUp(dir1, "go.mod")
+	return mod != "" && mod == findUp(dir2, "go.mod")
+}
+
+// workspaceFile dirで有効になるgo.workのパス。ワークスペースモードでなければ空文字を返す
+func workspaceFile(opt *Options, dir string) string {
+	switch gowork := opt.lookupEnv("GOWORK"); gowork {
+	case "off":
+		return ""
+	case "":
+		return findUp(dir, "go.work")
+	default:
+		return gowork
+	}
+}
+
+// existingDir dirが存在すればdirを、なければ存在する最も近い親ディレクトリを返す
+func existingDir(dir string) string {
+	for {
+		if _, err := os.Stat(dir); err == nil || filepath.Dir(dir) == dir {
+			return dir
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// workspaceUses go.workのuseディレクティブで指定されたディレクトリの絶対パス
+func workspaceUses(work string) ([]string, error) {
+	content, err := os.ReadFile(work)
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	block := false
+	for _, line := range strings.Split(string(content), "\n") {
+		if i := strings.Index(line, "//"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+
+		switch {
+		case len(fields) == 0:
+			continue
+		case block:
+			if fields[0] == ")" {
+				block = false
+				continue
+			}
+		case fields[0] == "use" && len(fields) > 1:
+			if fields[1] == "(" {
+				block = true
+				continue
+			}
+			fields = fields[1:]
+		default:
+			continue
+		}
+
+		dir := strings.Trim(fields[0], `"`)
+		if !filepath.IsAbs(dir) {
+			dir = filepath.Join(filepath.Dir(work), dir)
+		}
+		dirs = append(dirs, dir)
+	}
+
+	return dirs, nil
+}
+
+// findUp dirから親ディレクトリへ遡りnameのファイルを探す
+func findUp(dir, name string) string {
+	for {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
@@ -0,0 +1,154 @@
+package implstub
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+	"text/template"
+)
+
+const logDecoratorTemplate = `
+// {{.Name}} wraps {{.Iface}} and logs every method call.
+type {{.Name}} struct {
+	next   {{.Iface}}
+	logger {{.Logger}}
+}
+
+var _ {{.Iface}} = &{{.Name}}{}
+
+// New{{.Name}} returns a {{.IfaceName}} that logs the calls to next through logger.
+func New{{.Name}}(next {{.Iface}}, logger {{.Logger}}) *{{.Name}} {
+	return &{{.Name}}{next: next, logger: logger}
+}
+{{range .Methods}}
+// {{.Name}} logs the call and forwards it to the wrapped {{$.IfaceName}}.
+func (l *{{$.Name}}) {{.Name}}{{.Signature}} {
+	start := {{$.Time}}.Now()
+	{{if .Results}}{{.ResultVars}} := {{end}}l.next.{{.Name}}({{.Args}})
+	l.logger.{{$.LogMethod}}("{{$.IfaceName}}.{{.Name}}",{{range .Attrs}} "{{.Key}}", {{.Value}},{{end}} "duration", {{$.Time}}.Since(start))
+	{{- if .Results}}
+	return {{.ResultVars}}
+	{{- end}}
+}
+{{end}}`
+
+var logDecoratorTmpl = template.Must(template.New("logDecorator").Parse(logDecoratorTemplate))
+
+// logMethod ログを出力するメソッドの情報
+type logMethod struct {
+	*methodInfo
+	// Attrs ログに出力するキーと値
+	Attrs []logAttr
+	// vars 返り値を受け取る変数
+	vars []string
+}
+
+// logAttr ログに出力するキーと、値を参照する変数
+type logAttr struct {
+	Key   string
+	Value string
+}
+
+// ResultVars 返り値を受け取る変数をカンマで区切ったもの
+func (m *logMethod) ResultVars() string {
+	return strings.Join(m.vars, ", ")
+}
+
+// loggerType Options.Loggerの型を出力先から参照する型名にする
+// 識別子の場合は出力先のパッケージの型としてそのまま使い、log.Loggerのように修飾されている場合は読み込んだパッケージから探してimportを追加する
+// Logがポインタレシーバーのメソッドの場合はポインタ型にする
+func (g *genContext) loggerType(name string) (string, error) {
+	if token.IsIdentifier(name) {
+		return name, nil
+	}
+
+	pointer := strings.HasPrefix(name, "*")
+	qualified := strings.TrimPrefix(name, "*")
+	i := strings.LastIndex(qualified, ".")
+	if i <= 0 || !token.IsIdentifier(qualified[i+1:]) {
+		return "", fmt.Errorf("invalid logger type name: %q", name)
+	}
+
+	obj, err := g.lookupQualifiedType(qualified[:i], qualified[i+1:])
+	if err != nil {
+		return "", err
+	}
+
+	typ := obj.Type()
+	if pointer || types.NewMethodSet(typ).Lookup(obj.Pkg(), "Log") == nil {
+		typ = types.NewPointer(typ)
+	}
+	if types.NewMethodSet(typ).Lookup(obj.Pkg(), "Log") == nil {
+		return "", fmt.Errorf("the logger %s has no method Log", name)
+	}
+
+	return g.r.typeString(typ), nil
+}
+
+// genLogDecorator 呼び出しのメソッド名、引数、返り値、所要時間をログに出力してから返すラッパーを生成する
+// Options.Loggerがslogの場合は*slog.LoggerのInfo、それ以外はその名前の型のLog(msg string, keyvals ...interface{})で出力する
+// context.Contextを実装している引数はログに出力しない
+func genLogDecorator(g *genContext) ([]byte, error) {
+	reserved := []string{"l", "start"}
+	for i := 0; i < g.maxResults(); i++ {
+		reserved = append(reserved, fmt.Sprintf("r%d", i))
+	}
+
+	logger, logMethodName := "", ""
+	switch g.opt.Logger {
+	case "", "slog":
+		logger, logMethodName = "*"+g.importName("log/slog", "slog")+".Logger", "Info"
+	default:
+		var err error
+		logger, err = g.loggerType(g.opt.Logger)
+		if err != nil {
+			return nil, err
+		}
+		logMethodName = "Log"
+	}
+
+	var contextType *types.Interface
+	if t := g.lookupType("context", "Context"); t != nil {
+		contextType, _ = t.Underlying().(*types.Interface)
+	}
+	errorType := types.Universe.Lookup("error").Type()
+
+	var methods []*logMethod
+	for _, info := range g.methods(reserved...) {
+		m := &logMethod{methodInfo: info}
+
+		for i, p := range info.Params {
+			if contextType != nil && types.Implements(info.sig.Params().At(i).Type(), contextType) {
+				continue
+			}
+			m.Attrs = append(m.Attrs, logAttr{Key: p.Name, Value: p.Name})
+		}
+
+		for i := range info.Results {
+			v := fmt.Sprintf("r%d", i)
+			m.vars = append(m.vars, v)
+
+			key := v
+			switch {
+			case types.Identical(info.sig.Results().At(i).Type(), errorType):
+				key = "err"
+			case len(info.ResultNames) > 0 && info.ResultNames[i] != "_":
+				key = info.ResultNames[i]
+			}
+			m.Attrs = append(m.Attrs, logAttr{Key: key, Value: v})
+		}
+
+		methods = append(methods, m)
+	}
+
+	return g.execute(logDecoratorTmpl, map[string]interface{}{
+		"Name":      g.typeName("Logging%s"),
+		"Iface":     g.ifaceName(),
+		"IfaceName": g.ifaceObj.Name(),
+		"Logger":    logger,
+		"LogMethod": logMethodName,
+		"Time":      g.importName("time", "time"),
+		"Methods":   methods,
+	})
+}
@@ -0,0 +1,138 @@
+package implstub
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+)
+
+// methodStatus レシーバーのメソッドセットでのインターフェースのメソッドの状態
+type methodStatus int
+
+const (
+	// methodMissing 実装されていない
+	methodMissing methodStatus = iota
+	// methodDeclared 同じシグネチャのメソッドがある。埋め込みから昇格したものを含む
+	methodDeclared
+	// methodConflict 同じ名前で別のシグネチャのメソッドか、同じ名前のフィールドがある
+	methodConflict
+	// methodAmbiguous 同じ深さの複数の埋め込みから昇格していて、セレクタが曖昧になっている
+	methodAmbiguous
+	// methodUnimplementable 別のパッケージの非公開メソッドで、出力先のパッケージでは実装できない
+	methodUnimplementable
+)
+
+// lookupMethod 埋め込みによる昇格を含めたレシーバーのメソッドセットからmを探す
+// 返り値の文字列は状態の説明で、メソッドを提供している埋め込みフィールドなどを表す
+func (g *genContext) lookupMethod(m *types.Func) (methodStatus, string) {
+	// gRPCのmustEmbedUnimplementedXxxServerは埋め込んだUnimplementedXxxServerが提供する
+	if g.grpcBase != nil && m.Name() == mustEmbedPrefix+g.ifaceObj.Name() && (g.embedsGRPCBase || embeds(g.recv.Type(), g.grpcBase)) {
+		return methodDeclared, fmt.Sprintf("%s.%s (provided by the embedded %s)", g.recv.Name(), m.Name(), g.grpcBase.Name())
+	}
+	if g.foreignUnexported(m) {
+		return methodUnimplementable, fmt.Sprintf("%s.%s is an unexported method of the package %s", g.ifaceObj.Name(), m.Name(), m.Pkg().Path())
+	}
+
+	// メソッドを追加するレシーバーはアドレスを取れるものとして、ポインタレシーバーのメソッドも含める
+	obj, index, _ := types.LookupFieldOrMethod(g.recv.Type(), true, m.Pkg(), m.Name())
+	selector := g.recv.Name() + "." + m.Name()
+
+	switch obj := obj.(type) {
+	case nil:
+		if index != nil {
+			return methodAmbiguous, fmt.Sprintf("%s is ambiguous between the embedded fields %s", selector, strings.Join(ambiguousProviders(g.recv.Type(), m.Pkg(), m.Name()), ", "))
+		}
+		return methodMissing, ""
+	case *types.Func:
+		// UnimplementedXxxServerから昇格するRPCのメソッドはスタブを生成する対象にする
+		if len(index) > 1 && g.grpcBase != nil && sameTypeName(obj.Type().(*types.Signature).Recv().Type(), g.grpcBase) {
+			return methodMissing, ""
+		}
+
+		desc := selector
+		if len(index) > 1 {
+			desc = fmt.Sprintf("%s (promoted from %s)", selector, embeddedPath(g.recv.Type(), index[:len(index)-1]))
+		}
+
+		if signatureKey(obj.Type().(*types.Signature)) != signatureKey(m.Type().(*types.Signature)) {
+			return methodConflict, fmt.Sprintf("%s has a different signature from %s.%s", desc, g.ifaceObj.Name(), m.Name())
+		}
+		return methodDeclared, desc
+	default:
+		return methodConflict, fmt.Sprintf("%s is a field", selector)
+	}
+}
+
+// ambiguousProviders nameのメソッドかフィールドを最も浅い深さで提供している埋め込みフィールドの名前
+func ambiguousProviders(t types.Type, pkg *types.Package, name string) []string {
+	st, ok := t.Underlying().(*types.Struct)
+	if !ok {
+		return nil
+	}
+
+	var (
+		names []string
+		depth int
+	)
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		if !f.Embedded() {
+			continue
+		}
+
+		_, index, _ := types.LookupFieldOrMethod(f.Type(), true, pkg, name)
+		if index == nil {
+			continue
+		}
+
+		switch {
+		case names == nil || len(index) < depth:
+			names, depth = []string{f.Name()}, len(index)
+		case len(index) == depth:
+			names = append(names, f.Name())
+		}
+	}
+
+	return names
+}
+
+// embeddedPath インデックスで辿る埋め込みフィールドをBDB.Adb.Innerの形式で表す
+func embeddedPath(t types.Type, index []int) string {
+	names := []string{}
+	for _, i := range index {
+		if p, ok := t.Underlying().(*types.Pointer); ok {
+			t = p.Elem()
+		}
+
+		st, ok := t.Underlying().(*types.Struct)
+		if !ok {
+			break
+		}
+
+		f := st.Field(i)
+		names = append(names, f.Name())
+		t = f.Type()
+	}
+
+	return strings.Join(names, ".")
+}
+
+// signatureKey 引数名を除いたシグネチャを完全なパッケージパスで表す
+// 別々に読み込んだパッケージの型でも比較できるようにtypes.Identicalは使わない
+func signatureKey(sig *types.Signature) string {
+	tuple := func(t *types.Tuple, variadic bool) string {
+		list := make([]string, 0, t.Len())
+		for i := 0; i < t.Len(); i++ {
+			typ := t.At(i).Type()
+			if variadic && i == t.Len()-1 {
+				list = append(list, "..."+types.TypeString(typ.(*types.Slice).Elem(), nil))
+				continue
+			}
+			list = append(list, types.TypeString(typ, nil))
+		}
+
+		return "(" + strings.Join(list, ", ") + ")"
+	}
+
+	return tuple(sig.Params(), sig.Variadic()) + " " + tuple(sig.Results(), false)
+}
@@ -0,0 +1,69 @@
+package implstub
+
+import (
+	"text/template"
+)
+
+const mockTemplate = `
+// {{.Name}} is a mock implementation of {{.Iface}}.
+type {{.Name}} struct {
+{{- range .Methods}}
+	// {{.Exported}}Func mocks the {{.Name}} method.
+	{{.Exported}}Func {{.FuncType}}
+{{end}}
+	calls struct {
+{{- range .Methods}}
+		{{.Name}} []{{$.Name}}{{.Exported}}Call
+{{- end}}
+	}
+	lock {{.Sync}}.Mutex
+}
+
+var _ {{.Iface}} = &{{.Name}}{}
+{{range .Methods}}
+// {{$.Name}}{{.Exported}}Call holds the arguments of a call to {{.Name}}.
+type {{$.Name}}{{.Exported}}Call struct {
+{{- range .Params}}
+	{{exported .Name}} {{.FieldType}}
+{{- end}}
+}
+
+// {{.Name}} calls {{.Exported}}Func.
+func (mock *{{$.Name}}) {{.Name}}{{.Signature}} {
+	if mock.{{.Exported}}Func == nil {
+		panic("{{$.Name}}.{{.Exported}}Func: method is nil but {{$.IfaceName}}.{{.Name}} was just called")
+	}
+	callInfo := {{$.Name}}{{.Exported}}Call{
+{{- range .Params}}
+		{{exported .Name}}: {{.Name}},
+{{- end}}
+	}
+	mock.lock.Lock()
+	mock.calls.{{.Name}} = append(mock.calls.{{.Name}}, callInfo)
+	mock.lock.Unlock()
+	{{if .Results}}return {{end}}mock.{{.Exported}}Func({{.Args}})
+}
+
+// {{.Exported}}Calls returns the calls made to {{.Name}}.
+func (mock *{{$.Name}}) {{.Exported}}Calls() []{{$.Name}}{{.Exported}}Call {
+	mock.lock.Lock()
+	defer mock.lock.Unlock()
+	return append([]{{$.Name}}{{.Exported}}Call(nil), mock.calls.{{.Name}}...)
+}
+{{end}}`
+
+var mockTmpl = template.Must(template.New("mock").Funcs(template.FuncMap{
+	"exported": exportedName,
+}).Parse(mockTemplate))
+
+// genMock メソッドごとの関数フィールドを呼び出すモックを生成する
+// 呼び出し時の引数はmutexで保護したメソッドごとの履歴に記録する
+func genMock(g *genContext) ([]byte, error) {
+	return g.execute(mockTmpl, map[string]interface{}{
+		"Name":      g.typeName("%sMock"),
+		"Iface":     g.ifaceName(),
+		"IfaceName": g.ifaceObj.Name(),
+		"Sync":      g.importName("sync", "sync"),
+		"Methods":   g.methods("mock", "callInfo"),
+	})
+}
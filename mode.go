@@ -0,0 +1,545 @@
+package implstub
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// modeSpec Options.Modeごとの生成方法
+type modeSpec struct {
+	// recv 選択したレシーバーにメソッドを追加するモード。falseの場合はレシーバーを選択せず新しい型を生成する
+	recv bool
+	gen  func(g *genContext) ([]byte, error)
+}
+
+var modes = map[string]*modeSpec{
+	"stub":   {recv: true, gen: genStubMethods},
+	"mock":   {gen: genMock},
+	"gomock": {gen: genGomock},
+	// delegate 全てのメソッドをレシーバーのフィールドに委譲する
+	"delegate": {recv: true, gen: genDelegate},
+	// log-decorator 呼び出しをログに出力してから委譲するラッパーを生成する
+	"log-decorator": {gen: genLogDecorator},
+	// sync-wrapper 呼び出しをmutexで保護するラッパーを生成する
+	"sync-wrapper": {gen: genSyncWrapper},
+	// multi インターフェースのスライスで全ての実装を呼び出す型を生成する
+	"multi": {gen: genMulti},
+	// noop 何もせずにゼロ値を返す型を生成する
+	"noop": {gen: genNoop},
+	// func-adapter 関数をインターフェースとして使うためのアダプターを生成する
+	"func-adapter": {gen: genFuncAdapter},
+	// unimplemented 埋め込んで使う、実装されていないことを知らせる型を生成する
+	"unimplemented": {gen: genUnimplemented},
+}
+
+// modeSpec Options.Modeに対応する生成方法を返す
+func (opt *Options) modeSpec() (*modeSpec, error) {
+	name := opt.Mode
+	if name == "" {
+		name = "stub"
+	}
+
+	mode, ok := modes[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown mode: %s", name)
+	}
+
+	return mode, nil
+}
+
+// genContext コードの生成に必要な情報
+type genContext struct {
+	opt   *Options
+	r     *typeRenderer
+	edits *fileEdits
+	// ifaceObj, iface, ifacePkg 選択したインターフェースとそのパッケージ
+	ifaceObj *types.TypeName
+	iface    *types.Interface
+	ifacePkg *packages.Package
+	// recv, recvPkg, decl レシーバーを選択するモードでのみ設定される
+	recv    *types.TypeName
+	recvPkg *packages.Package
+	decl    *alreadyDecl
+	// grpcBase インターフェースがgRPCのXxxServerの場合のUnimplementedXxxServer
+	grpcBase *types.TypeName
+	// embedsGRPCBase grpcBaseをレシーバーに新しく埋め込んだ
+	embedsGRPCBase bool
+	// accessAccepted インターフェースを満たせないことを承知で生成を続ける
+	accessAccepted bool
+}
+
+// ifaceName 出力先のパッケージから見たインターフェースの型名
+func (g *genContext) ifaceName() string {
+	return g.r.typeString(g.ifaceObj.Type())
+}
+
+// typeName 生成する型の名前。Options.Nameが空の場合はインターフェース名をformatに渡して決める
+func (g *genContext) typeName(format string) string {
+	if g.opt.Name != "" {
+		return g.opt.Name
+	}
+
+	return fmt.Sprintf(format, g.ifaceObj.Name())
+}
+
+// importName pathのパッケージをimportに追加し、出力先で参照する名前を返す
+func (g *genContext) importName(path, name string) string {
+	return g.r.qualifier(types.NewPackage(path, name))
+}
+
+// methods インターフェースのメソッドを生成用の情報に変換する
+// reservedは生成するコードで使う名前で、引数名と重なる場合は引数名を変える
+func (g *genContext) methods(reserved ...string) []*methodInfo {
+	result := make([]*methodInfo, 0, g.iface.NumMethods())
+	for i := 0; i < g.iface.NumMethods(); i++ {
+		result = append(result, g.r.method(g.iface.Method(i), reserved...))
+	}
+
+	return result
+}
+
+// maxResults インターフェースのメソッドの返り値の数の最大値
+func (g *genContext) maxResults() int {
+	n := 0
+	for i := 0; i < g.iface.NumMethods(); i++ {
+		if l := g.iface.Method(i).Type().(*types.Signature).Results().Len(); l > n {
+			n = l
+		}
+	}
+
+	return n
+}
+
+// lookupType インターフェースのパッケージが依存しているパッケージからpath.nameの型を探す
+// 依存していない場合はnilを返す
+func (g *genContext) lookupType(path, name string) types.Type {
+	var found types.Type
+	packages.Visit([]*packages.Package{g.ifacePkg}, func(pkg *packages.Package) bool {
+		if found != nil {
+			return false
+		}
+		if pkg.PkgPath == path && pkg.Types != nil {
+			if obj, ok := pkg.Types.Scope().Lookup(name).(*types.TypeName); ok {
+				found = obj.Type()
+			}
+			return false
+		}
+		return true
+	}, nil)
+
+	return found
+}
+
+// lookupQualifiedType pkg.nameの型を探す。pkgはパッケージ名またはインポートパス
+// インターフェースとレシーバーのパッケージが依存しているパッケージから探し、見つからない場合はpkgをインポートパスとして読み込む
+func (g *genContext) lookupQualifiedType(pkg, name string) (*types.TypeName, error) {
+	roots := []*packages.Package{g.ifacePkg}
+	if g.recvPkg != nil {
+		roots = append(roots, g.recvPkg)
+	}
+
+	var found []*types.TypeName
+	packages.Visit(roots, func(p *packages.Package) bool {
+		if p.Types == nil || (p.PkgPath != pkg && p.Types.Name() != pkg) {
+			return true
+		}
+		if obj, ok := p.Types.Scope().Lookup(name).(*types.TypeName); ok && obj.Exported() {
+			for _, f := range found {
+				if f == obj {
+					return true
+				}
+			}
+			found = append(found, obj)
+		}
+		return true
+	}, nil)
+
+	switch len(found) {
+	case 0:
+	case 1:
+		return found[0], nil
+	default:
+		paths := make([]string, 0, len(found))
+		for _, obj := range found {
+			paths = append(paths, obj.Pkg().Path())
+		}
+		return nil, fmt.Errorf("%s.%s is ambiguous between the packages %s, specify the import path", pkg, name, strings.Join(paths, ", "))
+	}
+
+	config := g.opt.packagesConfig(packages.LoadAllSyntax)
+	if len(g.ifacePkg.GoFiles) > 0 {
+		config.Dir = filepath.Dir(g.ifacePkg.GoFiles[0])
+	}
+	pkgs, err := packages.Load(config, pkg)
+	if err == nil && len(pkgs) == 1 && len(pkgs[0].Errors) == 0 && pkgs[0].Types != nil {
+		if obj, ok := pkgs[0].Types.Scope().Lookup(name).(*types.TypeName); ok && obj.Exported() {
+			return obj, nil
+		}
+	}
+
+	return nil, fmt.Errorf("type %s.%s is not found in the packages the interface or the receiver depends on", pkg, name)
+}
+
+// implemented レシーバーのメソッドセットにmが既にあるか。実装済みの場合はその旨を標準出力に、それ以外の理由でスキップする場合や警告は標準エラーに出力する
+// 同じ名前で別のシグネチャのメソッドなどがある場合はスタブを追加してもコンパイルできないため、警告してスキップする
+// セレクタが曖昧な場合はレシーバーに直接メソッドを追加することで解消できるため、警告してスタブを生成する
+func (g *genContext) implemented(m *types.Func) bool {
+	status, desc := g.lookupMethod(m)
+	switch status {
+	case methodDeclared:
+		fmt.Println("skip already defined: " + desc)
+		return true
+	case methodConflict:
+		fmt.Fprintln(os.Stderr, "skip conflicting: "+desc)
+		return true
+	case methodAmbiguous:
+		fmt.Fprintln(os.Stderr, "warning: "+desc+"; adding the method to the receiver")
+	case methodUnimplementable:
+		fmt.Fprintln(os.Stderr, "skip unexported: "+desc)
+		return true
+	}
+
+	return false
+}
+
+// missing レシーバーのメソッドセットに足りないメソッドがあるか
+func (g *genContext) missing() bool {
+	for i := 0; i < g.iface.NumMethods(); i++ {
+		switch status, _ := g.lookupMethod(g.iface.Method(i)); status {
+		case methodMissing, methodAmbiguous:
+			return true
+		}
+	}
+
+	return false
+}
+
+// execute テンプレートを実行し、整形したソースを返す
+func (g *genContext) execute(tmpl *template.Template, data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return nil, err
+	}
+
+	pretty, err := format.Source(bytes.TrimLeft(buf.Bytes(), "\n"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to format generated code: %w\n%s", err, buf.String())
+	}
+
+	return pretty, nil
+}
+
+// methodInfo 生成するコードで使うメソッドの情報
+type methodInfo struct {
+	Name string
+	// Exported 先頭を大文字にしたメソッド名。生成する型のフィールド名などに使う
+	Exported string
+	// Params 名前のない引数やブランクの引数にも名前をつけたもの。可変長引数の型は...Tになる
+	Params   []paramSig
+	Variadic bool
+	// Results 返り値の型
+	Results []string
+	// ResultNames 名前つきの返り値の場合の名前。名前がない場合は空
+	ResultNames []string
+	// Zeros 返り値の型のゼロ値
+	Zeros []string
+
+	sig *types.Signature
+}
+
+// method メソッドを生成用の情報に変換する
+func (r *typeRenderer) method(m *types.Func, reserved ...string) *methodInfo {
+	sig := m.Type().(*types.Signature)
+	info := &methodInfo{
+		Name:     m.Name(),
+		Exported: exportedName(m.Name()),
+		Variadic: sig.Variadic(),
+		sig:      sig,
+	}
+
+	used := make(map[string]bool)
+	for _, name := range reserved {
+		used[name] = true
+	}
+	for i := 0; i < sig.Params().Len(); i++ {
+		used[sig.Params().At(i).Name()] = true
+	}
+	for i := 0; i < sig.Results().Len(); i++ {
+		used[sig.Results().At(i).Name()] = true
+	}
+
+	params := sig.Params()
+	for i := 0; i < params.Len(); i++ {
+		p := params.At(i)
+
+		name := p.Name()
+		if name == "" || name == "_" || contains(reserved, name) {
+			name = fmt.Sprintf("p%d", i)
+			for j := 0; used[name]; j++ {
+				name = fmt.Sprintf("p%d_%d", i, j)
+			}
+			used[name] = true
+		}
+
+		typ := r.typeString(p.Type())
+		if info.Variadic && i == params.Len()-1 {
+			typ = "..." + r.typeString(p.Type().(*types.Slice).Elem())
+		}
+
+		info.Params = append(info.Params, paramSig{Name: name, Type: typ})
+	}
+
+	results := sig.Results()
+	for i := 0; i < results.Len(); i++ {
+		info.Results = append(info.Results, r.typeString(results.At(i).Type()))
+		info.Zeros = append(info.Zeros, r.zeroValue(results.At(i).Type()))
+
+		name := results.At(i).Name()
+		if name == "" {
+			continue
+		}
+		if contains(reserved, name) {
+			name = fmt.Sprintf("r%d", i)
+			for j := 0; used[name]; j++ {
+				name = fmt.Sprintf("r%d_%d", i, j)
+			}
+			used[name] = true
+		}
+		info.ResultNames = append(info.ResultNames, name)
+	}
+
+	return info
+}
+
+// ParamList (msg string, ids ...int64) の形式の引数
+func (m *methodInfo) ParamList() string {
+	list := make([]string, 0, len(m.Params))
+	for _, p := range m.Params {
+		list = append(list, p.Name+" "+p.Type)
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(list, ", "))
+}
+
+// ResultList 返り値がなければ空、1つなら括弧なし、複数なら括弧つきの返り値
+func (m *methodInfo) ResultList() string {
+	switch len(m.Results) {
+	case 0:
+		return ""
+	case 1:
+		return m.Results[0]
+	default:
+		return fmt.Sprintf("(%s)", strings.Join(m.Results, ", "))
+	}
+}
+
+// NamedResultList 返り値に名前がある場合は名前を残した返り値
+func (m *methodInfo) NamedResultList() string {
+	if len(m.ResultNames) == 0 {
+		return m.ResultList()
+	}
+
+	list := make([]string, 0, len(m.Results))
+	for i, typ := range m.Results {
+		list = append(list, m.ResultNames[i]+" "+typ)
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(list, ", "))
+}
+
+// NamedSignature 返り値の名前を残したSignature
+func (m *methodInfo) NamedSignature() string {
+	return strings.TrimSpace(m.ParamList() + " " + m.NamedResultList())
+}
+
+// ZeroList 返り値のゼロ値をカンマで区切ったもの
+func (m *methodInfo) ZeroList() string {
+	return strings.Join(m.Zeros, ", ")
+}
+
+// Signature メソッド名に続ける引数と返り値
+func (m *methodInfo) Signature() string {
+	return strings.TrimSpace(m.ParamList() + " " + m.ResultList())
+}
+
+// FuncType 同じシグネチャの関数型
+func (m *methodInfo) FuncType() string {
+	return "func" + m.Signature()
+}
+
+// Args 引数をそのまま渡して呼び出すときの実引数。可変長引数は展開して渡す
+func (m *methodInfo) Args() string {
+	args := make([]string, 0, len(m.Params))
+	for _, p := range m.Params {
+		args = append(args, p.Name)
+	}
+	if m.Variadic && len(args) > 0 {
+		args[len(args)-1] += "..."
+	}
+
+	return strings.Join(args, ", ")
+}
+
+// FieldType 引数を構造体のフィールドに保存するときの型。可変長引数はスライスになる
+func (p paramSig) FieldType() string {
+	if strings.HasPrefix(p.Type, "...") {
+		return "[]" + strings.TrimPrefix(p.Type, "...")
+	}
+
+	return p.Type
+}
+
+// exportedName 先頭の文字を大文字にする
+func exportedName(name string) string {
+	if name == "" {
+		return name
+	}
+
+	runes := []rune(name)
+	runes[0] = unicode.ToUpper(runes[0])
+	return string(runes)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+// generateType レシーバーを選択せず、インターフェースから新しい型を生成する
+// 出力先の指定がない場合はインターフェースのパッケージに置く前提で生成する
+func generateType(opt *Options, mode *modeSpec) error {
+	pkgs, err := loadPackages(opt, packages.LoadAllSyntax, detectedInterface.FilePath)
+	if err != nil {
+		return err
+	}
+	interfacePkg := pkgs[0]
+
+	interfaceObj, targetInterface := findInterface(interfacePkg, detectedInterface.Name)
+	if interfaceObj == nil {
+		return errors.New("not found target")
+	}
+
+	dst := ""
+	switch {
+	case opt.Dest != "":
+		// 生成する型の名前はモードごとに決まるため、パターンで使えるのはOptions.Nameで指定した場合のみ
+		dst, err = resolveDest(opt, detectedInterface.FilePath, filepath.Dir(detectedInterface.FilePath), opt.Name)
+		if err != nil {
+			return err
+		}
+	case opt.Overwrite:
+		dst = detectedInterface.FilePath
+	case opt.Output != nil:
+		dst = *opt.Output
+	}
+
+	dstPkg := interfacePkg.Types
+	dstFile := syntaxOf(interfacePkg, detectedInterface.FilePath)
+	if dst != "" && dst != detectedInterface.FilePath {
+		dstPkg, err = destinationPackage(opt, dst)
+		if err != nil {
+			return err
+		}
+
+		dstFile = nil
+		if f, err := parser.ParseFile(token.NewFileSet(), dst, nil, parser.ImportsOnly); err == nil {
+			dstFile = f
+		}
+	}
+
+	edits := newFileEdits()
+	if dst != "" {
+		generated := dst
+		dst, err = checkGenerated(opt, edits, dst, interfaceObj.Name())
+		if err != nil {
+			return err
+		}
+		if dst != generated {
+			dstFile = nil
+			if f, err := parser.ParseFile(token.NewFileSet(), dst, nil, parser.ImportsOnly); err == nil {
+				dstFile = f
+			}
+		}
+	}
+
+	r := newTypeRenderer(dstPkg, dstFile)
+	g := &genContext{
+		opt:      opt,
+		r:        r,
+		edits:    edits,
+		ifaceObj: interfaceObj,
+		iface:    targetInterface,
+		ifacePkg: interfacePkg,
+	}
+	if err := g.confirmAccess(); err != nil {
+		return err
+	}
+
+	src, err := mode.gen(g)
+	if err != nil {
+		return err
+	}
+
+	// ファイルに書き出す場合は書き出す前に出力先のパッケージで型エラーにならないか確かめる
+	// 標準出力に書き出すコードはどこに置かれるかわからないため確かめない
+	if err := output(opt, edits, dst, dstPkg, src, r); err != nil {
+		return err
+	}
+	if dst != "" {
+		if err := verifyPackage(opt, edits, dst, dstPkg.Name()); err != nil {
+			return err
+		}
+	}
+
+	return edits.flush()
+}
+
+// destinationPackage fileNameを置くディレクトリのパッケージ
+// Goファイルがまだないディレクトリの場合もgo listで求めたパッケージパスを使う
+func destinationPackage(opt *Options, fileName string) (*types.Package, error) {
+	absPath, err := filepath.Abs(fileName)
+	if err != nil {
+		return nil, err
+	}
+	dir := filepath.Dir(absPath)
+
+	name, _, err := inspectPackageDir(dir, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// ディレクトリは書き出すときに作成するため、まだない場合は存在する親ディレクトリのパッケージパスから求める
+	existing := existingDir(dir)
+
+	config := opt.packagesConfig(packages.NeedName)
+	config.Dir = existing
+	pkgs, err := packages.Load(config, ".")
+	if err != nil || len(pkgs) == 0 || pkgs[0].PkgPath == "" {
+		return nil, fmt.Errorf("failed to resolve the package of %s", fileName)
+	}
+
+	rel, err := filepath.Rel(existing, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return types.NewPackage(path.Join(pkgs[0].PkgPath, filepath.ToSlash(rel)), name), nil
+}
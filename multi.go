@@ -0,0 +1,139 @@
+package implstub
+
+import (
+	"fmt"
+	"go/types"
+	"strings"
+	"text/template"
+)
+
+const multiTemplate = `
+// {{.Name}} calls every {{.IfaceName}} in order.
+type {{.Name}} []{{.Iface}}
+
+var _ {{.Iface}} = {{.Name}}(nil)
+{{range .Methods}}
+// {{.Name}} calls {{.Name}} of every {{$.IfaceName}} in order.
+func (m {{$.Name}}) {{.Name}}{{.Signature}} {
+{{- range .Values}}
+	var {{.Var}} {{.Type}}
+{{- end}}
+{{- if and .HasErr $.Join}}
+	var errs []error
+{{- end}}
+	for {{if .Values}}i{{else}}_{{end}}, impl := range m {
+		{{if .Vars}}{{.Vars}} := {{end}}impl.{{.Name}}({{.Args}})
+{{- if .Values}}
+		if i == 0 {
+{{- range $i, $v := .Values}}
+			{{$v.Var}} = v{{$i}}
+{{- end}}
+		}
+{{- end}}
+{{- if .HasErr}}
+		if err != nil {
+			{{if $.Join}}errs = append(errs, err){{else}}return {{.Return "err"}}{{end}}
+		}
+{{- end}}
+	}
+{{- if .Results}}
+	return {{.Return $.LastErr}}
+{{- end}}
+}
+{{end}}`
+
+var multiTmpl = template.Must(template.New("multi").Parse(multiTemplate))
+
+// multiMethod 全ての実装を呼び出すメソッドの情報
+type multiMethod struct {
+	*methodInfo
+	// Values 最初の実装の返り値を保存する変数。errorの返り値は含まない
+	Values []multiValue
+	// HasErr 最後の返り値がerror
+	HasErr bool
+}
+
+// multiValue 返り値を保存する変数とその型
+type multiValue struct {
+	Var  string
+	Type string
+}
+
+// Vars 呼び出しの返り値を受け取る変数
+func (m *multiMethod) Vars() string {
+	vars := make([]string, 0, len(m.Results))
+	for i := range m.Values {
+		vars = append(vars, fmt.Sprintf("v%d", i))
+	}
+	if m.HasErr {
+		vars = append(vars, "err")
+	}
+
+	return strings.Join(vars, ", ")
+}
+
+// Return 最初の実装の返り値にerrを加えた返り値
+func (m *multiMethod) Return(err string) string {
+	list := make([]string, 0, len(m.Results))
+	for _, v := range m.Values {
+		list = append(list, v.Var)
+	}
+	if m.HasErr {
+		list = append(list, err)
+	}
+
+	return strings.Join(list, ", ")
+}
+
+// genMulti インターフェースのスライスに、全ての要素のメソッドを順に呼び出すメソッドを生成する
+// errorを返すメソッドはOptions.MultiErrorがjoinの場合errors.Joinでまとめ、firstの場合は最初のエラーで中断して返す
+// error以外の返り値は最初の実装のものを返す
+func genMulti(g *genContext) ([]byte, error) {
+	join := true
+	switch g.opt.MultiError {
+	case "", "join":
+	case "first":
+		join = false
+	default:
+		return nil, fmt.Errorf("unknown multi-error: %s", g.opt.MultiError)
+	}
+
+	reserved := []string{"m", "i", "impl", "errs", "err"}
+	for i := 0; i < g.maxResults(); i++ {
+		reserved = append(reserved, fmt.Sprintf("r%d", i), fmt.Sprintf("v%d", i))
+	}
+
+	errorType := types.Universe.Lookup("error").Type()
+	hasErr := false
+	var methods []*multiMethod
+	for _, info := range g.methods(reserved...) {
+		m := &multiMethod{methodInfo: info}
+
+		results := info.sig.Results()
+		for i := 0; i < results.Len(); i++ {
+			if i == results.Len()-1 && types.Identical(results.At(i).Type(), errorType) {
+				m.HasErr = true
+				hasErr = true
+				continue
+			}
+			m.Values = append(m.Values, multiValue{Var: fmt.Sprintf("r%d", i), Type: info.Results[i]})
+		}
+
+		methods = append(methods, m)
+	}
+
+	lastErr := "nil"
+	// errorを返すメソッドがない場合はerrorsをimportしない
+	if join && hasErr {
+		lastErr = g.importName("errors", "errors") + ".Join(errs...)"
+	}
+
+	return g.execute(multiTmpl, map[string]interface{}{
+		"Name":      g.typeName("multi%s"),
+		"Iface":     g.ifaceName(),
+		"IfaceName": g.ifaceObj.Name(),
+		"Join":      join,
+		"LastErr":   lastErr,
+		"Methods":   methods,
+	})
+}
@@ -0,0 +1,209 @@
+package implstub
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"github.com/ktr0731/go-fuzzyfinder"
+	"github.com/pkg/errors"
+)
+
+// CreateNewType recvDir以下のファイルを選択し、name型の宣言を追加する
+// Options.Outputが指定されている場合はそのファイルに追加する
+func CreateNewType(recvDir, name string, opt *Options) (*Result, error) {
+	if opt.Output != nil {
+		return createType(*opt.Output, name, opt)
+	}
+
+	fileNames, err := FindGoFiles(recvDir, opt)
+	if err != nil {
+		return nil, err
+	}
+
+	// 既存のファイルに加えて型名から決めた新しいファイルも選べるようにする
+	newFile := filepath.Join(recvDir, snakeCase(name)+".go")
+	if _, err := os.Stat(newFile); err == nil {
+		newFile = ""
+	} else {
+		fileNames = append(fileNames, newFile)
+	}
+	if len(fileNames) == 0 {
+		return nil, fmt.Errorf("no go files found in %s", recvDir)
+	}
+
+	fileName := fileNames[0]
+	if len(fileNames) > 1 {
+		i, err := fuzzyfinder.Find(
+			fileNames,
+			func(i int) string {
+				if fileNames[i] == newFile {
+					return fileNames[i] + " (new file)"
+				}
+				return fileNames[i]
+			},
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		fileName = fileNames[i]
+	}
+
+	return createType(fileName, name, opt)
+}
+
+// createType fileNameにname型の宣言と、指定があればコンストラクタを追加する
+// ファイルが存在しない場合は同じディレクトリのパッケージ名で作成する
+// 宣言はまだ書き出さず、Generateで生成したコードと一緒に書き出す
+func createType(fileName, name string, opt *Options) (*Result, error) {
+	return createStruct(newFileEdits(), fileName, name, "", nil, opt)
+}
+
+// createStruct editsのfileNameにfieldsをフィールドに持つname構造体の宣言を追加する
+// importsは型の宣言に必要なimportで、ファイルのimport宣言に追加する
+func createStruct(edits *fileEdits, fileName, name, fields string, imports map[string]string, opt *Options) (*Result, error) {
+	if !token.IsIdentifier(name) {
+		return nil, fmt.Errorf("invalid type name: %q", name)
+	}
+
+	dir := filepath.Dir(fileName)
+	pkgName, declared, err := inspectPackageDir(dir, name)
+	if err != nil {
+		return nil, err
+	}
+	if declared {
+		return nil, fmt.Errorf("%s is already declared in %s", name, dir)
+	}
+
+	// 生成されたファイルに追加すると再生成で失われるため、型もスタブと同じ<型名>_impl.goに置く
+	fileName, err = checkGenerated(opt, edits, fileName, name)
+	if err != nil {
+		return nil, err
+	}
+
+	// importを追加できるように、ファイルが存在しない場合は先にパッケージ宣言だけを置く
+	content, err := edits.read(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if content == nil {
+		if err := edits.set(fileName, []byte(fmt.Sprintf("package %s\n\n", pkgName))); err != nil {
+			return nil, err
+		}
+	}
+
+	var buf bytes.Buffer
+	if fields == "" {
+		fmt.Fprintf(&buf, "// %s comments...\ntype %s struct{}\n", name, name)
+	} else {
+		fmt.Fprintf(&buf, "// %s comments...\ntype %s struct {\n%s}\n", name, name, fields)
+	}
+	if opt.Constructor {
+		fmt.Fprintf(&buf, "\n// New%s comments...\nfunc New%s() *%s {\n\treturn &%s{}\n}\n", name, name, name, name)
+	}
+
+	if err := edits.appendSource(fileName, buf.Bytes(), imports); err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Name:     name,
+		FilePath: fileName,
+		Created:  true,
+		edits:    edits,
+	}, nil
+}
+
+// inspectPackageDir dirのパッケージ名と、nameが既に宣言されているかを調べる
+// Goファイルがない場合はディレクトリ名をパッケージ名とする
+func inspectPackageDir(dir, name string) (string, bool, error) {
+	pkgName := filepath.Base(dir)
+	if abs, err := filepath.Abs(dir); err == nil {
+		pkgName = filepath.Base(abs)
+	}
+	pkgName = strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' {
+			return r
+		}
+		return -1
+	}, pkgName)
+
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return pkgName, false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	found := false
+	declared := false
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".go" || strings.HasSuffix(e.Name(), "_test.go") {
+			continue
+		}
+
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, e.Name()), nil, 0)
+		if err != nil {
+			return "", false, errors.Wrapf(err, "failed to parse %s", e.Name())
+		}
+
+		if !found {
+			pkgName = f.Name.Name
+			found = true
+		}
+		if f.Scope.Lookup(name) != nil {
+			declared = true
+		}
+	}
+
+	return pkgName, declared, nil
+}
+
+// stdin 確認の回答を読み込む標準入力
+// 呼び出しごとにbufio.Readerを作ると読み込み済みの後続の行が捨てられるため、プロセスで1つを使う
+var stdin = bufio.NewReader(os.Stdin)
+
+// promptLine 標準入力から1行読み込む
+func promptLine(msg string) (string, error) {
+	fmt.Fprint(os.Stderr, msg)
+
+	line, err := stdin.ReadString('\n')
+	if err != nil && line == "" {
+		// 入力がないまま終わった場合もプロンプトの後で改行しておく
+		fmt.Fprintln(os.Stderr)
+		return "", err
+	}
+
+	return strings.TrimSpace(line), nil
+}
+
+// snakeCase HogeDBRepository -> hoge_db_repository
+func snakeCase(s string) string {
+	runes := []rune(s)
+
+	var sb strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			// 単語の先頭になる大文字の前に区切りを入れる。DBのような連続した大文字は1単語として扱う
+			if i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]) || (i+1 < len(runes) && unicode.IsLower(runes[i+1]) && unicode.IsUpper(runes[i-1]))) {
+				sb.WriteRune('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
+
+// newTypeSpec 受け取り側の一覧で新しい型の作成を表す項目
+var newTypeSpec = &ast.TypeSpec{Name: ast.NewIdent("[create a new type]")}
@@ -0,0 +1,48 @@
+package implstub
+
+import (
+	"fmt"
+	"text/template"
+)
+
+const noopTemplate = `
+// {{.Name}} is a {{.IfaceName}} that does nothing.
+type {{.Name}} struct{}
+{{if .Var}}
+// {{.Var}} is a {{.IfaceName}} that does nothing.
+var {{.Var}} {{.Iface}} = {{.Name}}{}
+{{else}}
+var _ {{.Iface}} = {{.Name}}{}
+{{end}}
+{{- range .Methods}}
+// {{.Name}} does nothing{{if .Results}} and returns zero values{{end}}.
+func ({{$.Name}}) {{.Name}}{{.Signature}} {
+{{- if .Results}}
+	return {{.ZeroList}}
+{{end -}}
+}
+{{end}}`
+
+var noopTmpl = template.Must(template.New("noop").Parse(noopTemplate))
+
+// genNoop 全てのメソッドが何もせずにゼロ値を返す型を生成する
+// Options.NoopVarが指定された場合は型をnoopXxxとし、インターフェース型のNoopXxx変数を公開する
+func genNoop(g *genContext) ([]byte, error) {
+	name := g.typeName("Noop%s")
+	varName := ""
+	if g.opt.NoopVar {
+		name = g.typeName("noop%s")
+		varName = "Noop" + exportedName(g.ifaceObj.Name())
+		if name == varName {
+			return nil, fmt.Errorf("the type name %s conflicts with the variable", name)
+		}
+	}
+
+	return g.execute(noopTmpl, map[string]interface{}{
+		"Name":      name,
+		"Var":       varName,
+		"Iface":     g.ifaceName(),
+		"IfaceName": g.ifaceObj.Name(),
+		"Methods":   g.methods(),
+	})
+}
@@ -0,0 +1,164 @@
+package implstub
+
+import (
+	"fmt"
+	"go/ast"
+	"go/types"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// typeRenderer 出力先のパッケージから見た型名を組み立て、必要なimportを集める
+type typeRenderer struct {
+	// pkg 出力先のパッケージ。このパッケージの型は修飾しない
+	pkg *types.Package
+	// names importパスごとの出力先ファイルでのパッケージ名
+	names map[string]string
+	// added 出力先ファイルに追加が必要なimport。値は別名が必要な場合の別名
+	added map[string]string
+}
+
+// newTypeRenderer 出力先のパッケージと、既にあるimportを元にtypeRendererを作成する
+// fileがnilの場合は既存のimportを考慮しない
+func newTypeRenderer(pkg *types.Package, file *ast.File) *typeRenderer {
+	r := &typeRenderer{
+		pkg:   pkg,
+		names: make(map[string]string),
+		added: make(map[string]string),
+	}
+	if file == nil {
+		return r
+	}
+
+	imported := make(map[string]*types.Package)
+	if pkg != nil {
+		for _, p := range pkg.Imports() {
+			imported[p.Path()] = p
+		}
+	}
+
+	for _, spec := range file.Imports {
+		importPath, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+
+		var name string
+		switch {
+		case spec.Name != nil:
+			name = spec.Name.Name
+		case imported[importPath] != nil:
+			name = imported[importPath].Name()
+		default:
+			name = path.Base(importPath)
+		}
+		// ブランクインポートやドットインポートは型の修飾に使えない
+		if name == "_" || name == "." {
+			continue
+		}
+
+		r.names[importPath] = name
+	}
+
+	return r
+}
+
+// qualifier types.TypeStringなどに渡すtypes.Qualifier
+func (r *typeRenderer) qualifier(p *types.Package) string {
+	if r.pkg != nil && p.Path() == r.pkg.Path() {
+		return ""
+	}
+	if name, ok := r.names[p.Path()]; ok {
+		return name
+	}
+
+	// 同じ名前のパッケージが既にあれば別名をつける
+	name := p.Name()
+	for i := 2; r.nameUsed(name); i++ {
+		name = fmt.Sprintf("%s%d", p.Name(), i)
+	}
+
+	r.names[p.Path()] = name
+	r.added[p.Path()] = ""
+	if name != p.Name() {
+		r.added[p.Path()] = name
+	}
+
+	return name
+}
+
+func (r *typeRenderer) nameUsed(name string) bool {
+	for _, n := range r.names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// typeString 出力先のパッケージから見た型名
+func (r *typeRenderer) typeString(t types.Type) string {
+	return types.TypeString(t, r.qualifier)
+}
+
+// params (msg string, id int64) の形式で引数を組み立てる
+func (r *typeRenderer) params(sig *types.Signature) string {
+	params := sig.Params()
+	list := make([]string, 0, params.Len())
+	for i := 0; i < params.Len(); i++ {
+		p := params.At(i)
+
+		typ := r.typeString(p.Type())
+		if sig.Variadic() && i == params.Len()-1 {
+			typ = "..." + r.typeString(p.Type().(*types.Slice).Elem())
+		}
+
+		if p.Name() == "" {
+			list = append(list, typ)
+			continue
+		}
+		list = append(list, p.Name()+" "+typ)
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(list, ", "))
+}
+
+// results (string, error) の形式で返り値を組み立てる
+func (r *typeRenderer) results(sig *types.Signature) string {
+	results := sig.Results()
+	list := make([]string, 0, results.Len())
+	for i := 0; i < results.Len(); i++ {
+		v := results.At(i)
+
+		if v.Name() == "" {
+			list = append(list, r.typeString(v.Type()))
+			continue
+		}
+		list = append(list, v.Name()+" "+r.typeString(v.Type()))
+	}
+
+	return fmt.Sprintf("(%s)", strings.Join(list, ", "))
+}
+
+// zeroValue 出力先のパッケージでtのゼロ値を表す式
+func (r *typeRenderer) zeroValue(t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return "false"
+		case u.Info()&types.IsNumeric != 0:
+			return "0"
+		case u.Info()&types.IsString != 0:
+			return `""`
+		default:
+			return "nil"
+		}
+	case *types.Struct, *types.Array:
+		return r.typeString(t) + "{}"
+	default:
+		return "nil"
+	}
+}
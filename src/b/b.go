@@ -1,8 +1,8 @@
 package b
 
 import (
-	"implstub/src/a"
-	"implstub/src/a/c"
+	"github.com/YuuSatoh/implstub/src/a"
+	"github.com/YuuSatoh/implstub/src/a/c"
 )
 
 // Hoge interface
@@ -0,0 +1,125 @@
+package implstub
+
+import (
+	"fmt"
+	"go/ast"
+	"strings"
+	"text/template"
+)
+
+const syncWrapperTemplate = `
+// {{.Name}} wraps {{.Iface}} and guards every method call with a mutex.
+type {{.Name}} struct {
+	mu   {{.Sync}}.{{.Mutex}}
+	next {{.Iface}}
+}
+
+var _ {{.Iface}} = &{{.Name}}{}
+
+// New{{.Name}} returns a {{.IfaceName}} that is safe for concurrent use.
+func New{{.Name}}(next {{.Iface}}) *{{.Name}} {
+	return &{{.Name}}{next: next}
+}
+{{range .Methods}}
+// {{.Name}} forwards the call to the wrapped {{$.IfaceName}} while holding the {{if .ReadOnly}}read {{end}}lock.
+func (s *{{$.Name}}) {{.Name}}{{.Signature}} {
+	s.mu.{{if .ReadOnly}}RLock{{else}}Lock{{end}}()
+	defer s.mu.{{if .ReadOnly}}RUnlock{{else}}Unlock{{end}}()
+	{{if .Results}}return {{end}}s.next.{{.Name}}({{.Args}})
+}
+{{end}}`
+
+var syncWrapperTmpl = template.Must(template.New("syncWrapper").Parse(syncWrapperTemplate))
+
+// readOnlyAnnotation インターフェースのメソッドのコメントに書くと読み取りのロックを使う
+const readOnlyAnnotation = "implstub:readonly"
+
+// syncMethod ロックを取って委譲するメソッドの情報
+type syncMethod struct {
+	*methodInfo
+	// ReadOnly RLockで呼び出す
+	ReadOnly bool
+}
+
+// genSyncWrapper メソッドの呼び出しをmutexで保護してから委譲するラッパーを生成する
+// Options.ReadOnlyで指定したメソッドと、コメントにimplstub:readonlyがあるメソッドはRLockを使う
+func genSyncWrapper(g *genContext) ([]byte, error) {
+	readOnly := g.readOnlyAnnotated()
+	for _, name := range g.opt.ReadOnly {
+		found := false
+		for i := 0; i < g.iface.NumMethods(); i++ {
+			if g.iface.Method(i).Name() == name {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%s has no method %s", g.ifaceObj.Name(), name)
+		}
+
+		readOnly[name] = true
+	}
+
+	mutex := "Mutex"
+	var methods []*syncMethod
+	for _, info := range g.methods("s") {
+		methods = append(methods, &syncMethod{methodInfo: info, ReadOnly: readOnly[info.Name]})
+		if readOnly[info.Name] {
+			mutex = "RWMutex"
+		}
+	}
+
+	return g.execute(syncWrapperTmpl, map[string]interface{}{
+		"Name":      g.typeName("Sync%s"),
+		"Iface":     g.ifaceName(),
+		"IfaceName": g.ifaceObj.Name(),
+		"Sync":      g.importName("sync", "sync"),
+		"Mutex":     mutex,
+		"Methods":   methods,
+	})
+}
+
+// readOnlyAnnotated インターフェースの宣言で、コメントにimplstub:readonlyがあるメソッド
+func (g *genContext) readOnlyAnnotated() map[string]bool {
+	result := make(map[string]bool)
+	for _, syntax := range g.ifacePkg.Syntax {
+		ast.Inspect(syntax, func(node ast.Node) bool {
+			t, ok := node.(*ast.TypeSpec)
+			if !ok || g.ifacePkg.TypesInfo.Defs[t.Name] != g.ifaceObj {
+				return true
+			}
+
+			it, ok := t.Type.(*ast.InterfaceType)
+			if !ok {
+				return false
+			}
+			for _, field := range it.Methods.List {
+				if !hasAnnotation(field.Doc, readOnlyAnnotation) && !hasAnnotation(field.Comment, readOnlyAnnotation) {
+					continue
+				}
+				for _, name := range field.Names {
+					result[name.Name] = true
+				}
+			}
+			return false
+		})
+	}
+
+	return result
+}
+
+// hasAnnotation コメントにannotationで始まる行があるか
+func hasAnnotation(doc *ast.CommentGroup, annotation string) bool {
+	if doc == nil {
+		return false
+	}
+
+	for _, c := range doc.List {
+		text := strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(c.Text, "//"), "/*"))
+		if strings.HasPrefix(text, annotation) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -2,3 +2,10 @@ package c
 
 type CDB struct {
 }
+
+// CBase implements b.Bar and is embedded from another package
+type CBase struct{}
+
+func (CBase) Bow(db CDB) (err error) {
+	panic("not implemented") // TODO: Implement
+}
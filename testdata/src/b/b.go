@@ -1,8 +1,8 @@
 package b
 
 import (
-	"implstub/src/a"
-	"implstub/src/a/c"
+	"github.com/YuuSatoh/implstub/testdata/src/a"
+	"github.com/YuuSatoh/implstub/testdata/src/a/c"
 )
 
 // Hoge interface
@@ -13,6 +13,26 @@ type Hoge interface {
 	piyo(adb a.ADB, db BDB) error
 }
 
+// Cache interface
+type Cache interface {
+	// implstub:readonly
+	get(key string) string
+	set(key string, value string)
+}
+
+// Bar interface
+type Bar interface {
+	// Bow hogehoge.
+	Bow(db c.CDB) (err error)
+}
+
+// Baz interface refers to an unexported type
+type Baz interface {
+	Qux(s secret) error
+}
+
+type secret struct{}
+
 type Foo interface {
 	// bow hogehoge.
 	bow(db c.CDB) (err error)
@@ -29,3 +49,51 @@ type BDB struct {
 
 type BResis struct {
 }
+
+// BFoo embeds the base implementation of Foo
+type BFoo struct {
+	*unimplementedFoo
+}
+
+type unimplementedFoo struct{}
+
+func (unimplementedFoo) bow(db c.CDB) (err error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// BNext embeds Foo itself
+type BNext struct {
+	Foo
+}
+
+// BAmbiguous embeds two types providing yey at the same depth
+type BAmbiguous struct {
+	ayey
+	byey
+}
+
+type ayey struct{}
+
+func (ayey) yey(msg string, id int64) (string, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+type byey struct{}
+
+func (byey) yey(msg string, id int64) (string, error) {
+	panic("not implemented") // TODO: Implement
+}
+
+// BBase embeds a type of another package providing Bow
+type BBase struct {
+	c.CBase
+}
+
+// BIDs is a receiver that is not a struct
+type BIDs []int
+
+// BAlias is an alias of a type in another package
+type BAlias = a.ADB
+
+// BPtr is a pointer type and cannot have methods
+type BPtr *BDB
@@ -0,0 +1,12 @@
+package generic
+
+// Lener interface
+type Lener interface {
+	Len() int
+}
+
+// Set has a type parameter
+type Set[T comparable] map[T]struct{}
+
+// IntSet is an alias of an instance of Set
+type IntSet = Set[int]
@@ -0,0 +1,69 @@
+package implstub
+
+import (
+	"go/types"
+	"text/template"
+)
+
+const unimplementedTemplate = `
+// {{.Name}} can be embedded to have forward compatible implementations of {{.IfaceName}}.
+type {{.Name}} struct{}
+
+var _ {{.Iface}} = {{.Name}}{}
+{{range .Methods}}
+// {{.Name}} is not implemented.
+func ({{$.Name}}) {{.Name}}{{.Signature}} {
+{{- if .ReturnsErr}}
+	return {{.ZeroPrefix}}{{$.Errors}}.New("{{$.IfaceName}}.{{.Name}} is not implemented")
+{{- else}}
+	panic("{{$.IfaceName}}.{{.Name}} is not implemented")
+{{- end}}
+}
+{{end}}`
+
+var unimplementedTmpl = template.Must(template.New("unimplemented").Parse(unimplementedTemplate))
+
+// unimplementedMethod 実装されていないことを知らせるメソッドの情報
+type unimplementedMethod struct {
+	*methodInfo
+	// ReturnsErr 最後の返り値がerrorで、panicせずにエラーを返す
+	ReturnsErr bool
+}
+
+// ZeroPrefix error以外の返り値のゼロ値。errorの前に続けるため末尾にカンマをつける
+func (m *unimplementedMethod) ZeroPrefix() string {
+	list := ""
+	for _, zero := range m.Zeros[:len(m.Zeros)-1] {
+		list += zero + ", "
+	}
+
+	return list
+}
+
+// genUnimplemented gRPCのUnimplementedXxxServerのように、埋め込むことでインターフェースを満たす型を生成する
+// 最後の返り値がerrorのメソッドは実装されていないことを表すエラーを返し、それ以外はpanicする
+func genUnimplemented(g *genContext) ([]byte, error) {
+	errorType := types.Universe.Lookup("error").Type()
+
+	errs := ""
+	var methods []*unimplementedMethod
+	for _, info := range g.methods() {
+		m := &unimplementedMethod{methodInfo: info}
+
+		results := info.sig.Results()
+		if results.Len() > 0 && types.Identical(results.At(results.Len()-1).Type(), errorType) {
+			m.ReturnsErr = true
+			errs = g.importName("errors", "errors")
+		}
+
+		methods = append(methods, m)
+	}
+
+	return g.execute(unimplementedTmpl, map[string]interface{}{
+		"Name":      g.typeName("Unimplemented%s"),
+		"Iface":     g.ifaceName(),
+		"IfaceName": g.ifaceObj.Name(),
+		"Errors":    errs,
+		"Methods":   methods,
+	})
+}
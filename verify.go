@@ -0,0 +1,183 @@
+package implstub
+
+import (
+	"fmt"
+	"go/types"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// verifyReceiver 書き出す前の変更をoverlayとして読み込み直し、型エラーがなくレシーバーがインターフェースを実装するか確かめる
+// 問題があれば位置つきで表示し、エラーを返す
+func (g *genContext) verifyReceiver(edits *fileEdits, recvFile string) error {
+	if len(edits.order) == 0 {
+		return nil
+	}
+
+	interfacePkg, recvPkg, err := g.loadForVerify(edits, recvFile)
+	if err != nil {
+		return err
+	}
+
+	problems := newErrors(g.recvPkg.Errors, recvPkg.Errors, edits)
+
+	// アクセスできないメソッドを承知の上で生成した場合は実装しないことがわかっている
+	if len(problems) == 0 && !g.accessAccepted {
+		if p := g.checkImplements(interfacePkg, recvPkg); p != "" {
+			problems = append(problems, p)
+		}
+	}
+
+	return reportProblems(problems)
+}
+
+// verifyPackage 書き出す前の変更をoverlayとしてfileNameのパッケージを読み込み直し、変更で型エラーが増えないか確かめる
+// 新しい型を生成するモードで使い、var _ Iface = ...の検査もここで行われる
+func verifyPackage(opt *Options, edits *fileEdits, fileName, pkgName string) error {
+	absPath, err := filepath.Abs(fileName)
+	if err != nil {
+		return err
+	}
+
+	// ファイルがまだない場合はパッケージ宣言だけのファイルがあるものとして変更前の型エラーを求める
+	base := make(map[string][]byte)
+	if _, err := os.Stat(absPath); os.IsNotExist(err) {
+		base[absPath] = []byte(fmt.Sprintf("package %s\n", pkgName))
+	}
+	before, err := loadPackagesWithOverlay(opt, packages.LoadAllSyntax, base, absPath)
+	if err != nil {
+		return err
+	}
+	after, err := loadPackagesWithOverlay(opt, packages.LoadAllSyntax, edits.contents, absPath)
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	for _, p := range newErrors(before[0].Errors, after[0].Errors, edits) {
+		// gomockのように生成したコードが使うモジュールは後から追加できるため、importできないことは問題にしない
+		if strings.Contains(p, "could not import ") {
+			continue
+		}
+		problems = append(problems, p)
+	}
+
+	return reportProblems(problems)
+}
+
+// newErrors afterの型エラーのうちbeforeになかったもの。元から存在した型エラーは生成したコードの問題ではない
+func newErrors(before, after []packages.Error, edits *fileEdits) []string {
+	known := make(map[string]bool)
+	for _, e := range before {
+		known[errorKey(e, edits)] = true
+	}
+
+	var problems []string
+	for _, e := range after {
+		if known[errorKey(e, edits)] {
+			continue
+		}
+		problems = append(problems, e.Error())
+	}
+
+	return problems
+}
+
+// reportProblems problemsを標準エラーに表示し、1つでもあればエラーを返す
+func reportProblems(problems []string) error {
+	if len(problems) == 0 {
+		return nil
+	}
+
+	for _, p := range problems {
+		fmt.Fprintln(os.Stderr, p)
+	}
+
+	return fmt.Errorf("verification failed: %d problem(s) found, nothing was written", len(problems))
+}
+
+// loadForVerify 変更をoverlayとしてインターフェースとレシーバーのパッケージを読み込み直す
+// 別々に読み込むモジュールの場合は型を比較できるように、レシーバーのモジュールからインターフェースのパッケージを解決する
+func (g *genContext) loadForVerify(edits *fileEdits, recvFile string) (interfacePkg, recvPkg *packages.Package, err error) {
+	ifaceFile, err := filepath.Abs(detectedInterface.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	absRecvFile, err := filepath.Abs(recvFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if !loadableTogether(g.opt, filepath.Dir(ifaceFile), filepath.Dir(absRecvFile)) {
+		recvPkg, interfacePkg, err = loadPackageWithImport(g.opt, packages.LoadAllSyntax, edits.contents, recvFile, g.ifaceObj.Pkg().Path())
+		if err != nil || interfacePkg != nil {
+			return interfacePkg, recvPkg, err
+		}
+	}
+
+	// レシーバーのモジュールから解決できない場合は別々に読み込んだものを使う
+	pkgs, err := loadPackagesWithOverlay(g.opt, packages.LoadAllSyntax, edits.contents, detectedInterface.FilePath, recvFile)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return pkgs[0], pkgs[1], nil
+}
+
+// checkImplements 読み込み直したパッケージでレシーバーかそのポインタがインターフェースを実装するか確かめる
+// 実装する場合は空文字列を、しない場合は位置つきの説明を返す
+func (g *genContext) checkImplements(interfacePkg, recvPkg *packages.Package) string {
+	recvObj, ok := recvPkg.Types.Scope().Lookup(g.recv.Name()).(*types.TypeName)
+	if !ok {
+		return fmt.Sprintf("%s: not found", g.recv.Name())
+	}
+	pos := recvPkg.Fset.Position(recvObj.Pos())
+
+	// 型を比較できるようにレシーバーのパッケージから辿れるインターフェースを使う
+	ifacePkg := interfacePkg.Types
+	packages.Visit([]*packages.Package{recvPkg}, nil, func(p *packages.Package) {
+		if p.PkgPath == g.ifaceObj.Pkg().Path() {
+			ifacePkg = p.Types
+		}
+	})
+	ifaceObj, ok := ifacePkg.Scope().Lookup(g.ifaceObj.Name()).(*types.TypeName)
+	if !ok {
+		return fmt.Sprintf("%s: %s not found", pos, g.ifaceObj.Name())
+	}
+	iface, ok := ifaceObj.Type().Underlying().(*types.Interface)
+	if !ok {
+		return fmt.Sprintf("%s: %s is not an interface", pos, g.ifaceObj.Name())
+	}
+
+	ptr := types.NewPointer(recvObj.Type())
+	if types.Implements(ptr, iface) {
+		return ""
+	}
+
+	m, wrongType := types.MissingMethod(ptr, iface, true)
+	if wrongType {
+		return fmt.Sprintf("%s: %s does not implement %s: wrong type for method %s", pos, recvObj.Name(), ifaceObj.Name(), m.Name())
+	}
+
+	return fmt.Sprintf("%s: %s does not implement %s: missing method %s", pos, recvObj.Name(), ifaceObj.Name(), m.Name())
+}
+
+// errorKey 変更の前後で同じ型エラーを見分けるためのキー
+// 変更したファイルでは行がずれるため、位置を除いたメッセージで比べる
+func errorKey(e packages.Error, edits *fileEdits) string {
+	fileName := e.Pos
+	// file:line:col の形式から行と列を取り除く
+	for i := 0; i < 2; i++ {
+		if j := strings.LastIndex(fileName, ":"); j >= 0 {
+			fileName = fileName[:j]
+		}
+	}
+	if _, ok := edits.contents[fileName]; ok {
+		return fileName + ": " + e.Msg
+	}
+
+	return e.Error()
+}
@@ -0,0 +1,82 @@
+package implstub
+
+import (
+	"fmt"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// checkDestination dstがレシーバーと同じパッケージのファイルか確認する
+// 違う場合はその理由を返す。Goでは別のパッケージの型にメソッドを定義できない
+func checkDestination(dst string, recvPkg *packages.Package, recvFile string) (string, error) {
+	dstAbs, err := filepath.Abs(dst)
+	if err != nil {
+		return "", err
+	}
+	recvAbs, err := filepath.Abs(recvFile)
+	if err != nil {
+		return "", err
+	}
+
+	if filepath.Dir(dstAbs) != filepath.Dir(recvAbs) {
+		return fmt.Sprintf("%s is not in the directory of the package %s (%s)", dst, recvPkg.Name, filepath.Dir(recvAbs)), nil
+	}
+
+	f, err := parser.ParseFile(token.NewFileSet(), dstAbs, nil, parser.PackageClauseOnly)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if f.Name.Name != recvPkg.Name {
+		return fmt.Sprintf("%s belongs to the package %s, not %s", dst, f.Name.Name, recvPkg.Name), nil
+	}
+
+	return "", nil
+}
+
+// wrapReceiver 出力先のパッケージにレシーバーの型を埋め込んだラッパー型を作成し、そのラッパーにインターフェースを実装する
+// Options.Wrapが指定されていない場合は確認し、断られた場合はreasonをエラーとして返す
+func wrapReceiver(opt *Options, edits *fileEdits, dst, reason string, recv *types.TypeName) error {
+	if !recv.Exported() {
+		return fmt.Errorf("%s: methods of %s must be declared in its package, and the unexported type cannot be embedded in another package", reason, recv.Name())
+	}
+
+	name := opt.Name
+	if name == "" {
+		name = recv.Name() + "Wrapper"
+	}
+
+	if !opt.Wrap {
+		answer, err := promptLine(fmt.Sprintf("%s.\ncreate %s embedding %s in %s instead? [y/N]: ", reason, name, types.TypeString(recv.Type(), nil), dst))
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if !strings.EqualFold(answer, "y") && !strings.EqualFold(answer, "yes") {
+			return fmt.Errorf("%s: methods of %s must be declared in its package, use --wrap to create a wrapper type", reason, recv.Name())
+		}
+	}
+
+	dstPkg, err := destinationPackage(opt, dst)
+	if err != nil {
+		return err
+	}
+	dstFile, _ := parser.ParseFile(token.NewFileSet(), dst, nil, parser.ImportsOnly)
+
+	r := newTypeRenderer(dstPkg, dstFile)
+	wrapper, err := createStruct(edits, dst, name, "\t"+r.typeString(recv.Type())+"\n", r.added, opt)
+	if err != nil {
+		return err
+	}
+
+	// ラッパーを新しいレシーバーとして、埋め込んだ型から昇格しないメソッドを実装する
+	return Generate(opt, detectedInterface, wrapper)
+}